@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	casPrefix   = "/blob/"
+	casMaxFiles = 100000
+	casRescan   = 10 * time.Second
+)
+
+type casIndex struct {
+	lock     sync.Mutex
+	paths    map[string]string
+	scanned  time.Time
+	scanning chan struct{}
+}
+
+func (h *StaticHandler) scanBlobs() (paths map[string]string, err error) {
+	paths = map[string]string{}
+	seen := map[string]bool{}
+	count := 0
+
+	for _, root := range h.roots() {
+		err = filepath.Walk(root, func(path string, info os.FileInfo,
+			e error) error {
+
+			if e != nil {
+				if os.IsPermission(e) || os.IsNotExist(e) {
+					return nil
+				}
+				return e
+			}
+
+			relPath, e := filepath.Rel(root, path)
+			if e != nil {
+				return e
+			}
+			if path == root {
+				return nil
+			}
+
+			if h.hiddenFromListing(info.Name()) ||
+				h.MaxDepth > 0 && pathDepth(relPath) > h.MaxDepth {
+
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !info.Mode().IsRegular() || seen[relPath] ||
+				!h.ownedBy(info) {
+
+				return nil
+			}
+			seen[relPath] = true
+
+			count += 1
+			if count > casMaxFiles {
+				return filepath.SkipAll
+			}
+
+			sum, e := h.checksums.Sum(path, "sha256", info)
+			if e != nil {
+				if os.IsPermission(e) || os.IsNotExist(e) {
+					return nil
+				}
+				return e
+			}
+
+			key := hex.EncodeToString(sum)
+			if _, ok := paths[key]; !ok {
+				paths[key] = path
+			}
+
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if count > casMaxFiles {
+		fmt.Fprintf(gin.DefaultErrorWriter,
+			"[WARN] %s | content index limited to %d files\n",
+			time.Now().Format("2006/01/02 - 15:04:05"), casMaxFiles)
+	}
+
+	return
+}
+
+func (h *StaticHandler) rescanBlobs() (err error) {
+	h.cas.lock.Lock()
+	if h.cas.scanning != nil {
+		done := h.cas.scanning
+		h.cas.lock.Unlock()
+		<-done
+		return
+	}
+	if h.cas.paths != nil && time.Since(h.cas.scanned) < casRescan {
+		h.cas.lock.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	h.cas.scanning = done
+	h.cas.lock.Unlock()
+
+	paths, err := h.scanBlobs()
+
+	h.cas.lock.Lock()
+	if err != nil {
+		h.cas.paths = nil
+	} else {
+		h.cas.paths = paths
+		h.cas.scanned = time.Now()
+	}
+	h.cas.scanning = nil
+	h.cas.lock.Unlock()
+	close(done)
+
+	return
+}
+
+func (h *StaticHandler) lookupBlob(sum string) (path string,
+	info os.FileInfo, err error) {
+
+	for attempt := 0; attempt < 2; attempt++ {
+		h.cas.lock.Lock()
+		path = h.cas.paths[sum]
+		h.cas.lock.Unlock()
+
+		if path != "" {
+			info, err = os.Stat(path)
+			if err == nil {
+				current, e := h.checksums.Sum(path, "sha256", info)
+				if e == nil && hex.EncodeToString(current) == sum {
+					return
+				}
+			}
+		}
+
+		path = ""
+		info = nil
+		err = nil
+
+		if attempt == 0 {
+			err = h.rescanBlobs()
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (h *StaticHandler) HandleBlob(c *gin.Context) {
+	sum := strings.ToLower(strings.TrimPrefix(c.Param("filepath"),
+		h.CASPrefix))
+	decoded, err := hex.DecodeString(sum)
+	if err != nil || len(decoded) != 32 {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	path, info, err := h.lookupBlob(sum)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	if path == "" {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	err = h.verifyFile(path)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	writer, release, allowed := h.fileWriter(c)
+	defer release()
+	if !allowed {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		c.AbortWithStatus(404)
+		return
+	}
+	defer file.Close()
+
+	c.Writer.Header().Set("Cache-Control",
+		"public, max-age=31536000, immutable")
+	c.Writer.Header().Set("ETag", `"`+sum+`"`)
+	http.ServeContent(writer, c.Request, info.Name(), info.ModTime(),
+		file)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const foldCacheMaxEntries = 1024
+
+type foldEntry struct {
+	modTime time.Time
+	names   []string
+}
+
+type foldCache struct {
+	lock    sync.Mutex
+	entries map[string]foldEntry
+}
+
+func (s *foldCache) Names(dir string) (names []string, err error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	entry, ok := s.entries[dir]
+	s.lock.Unlock()
+
+	if ok && entry.modTime.Equal(info.ModTime()) {
+		names = entry.names
+		return
+	}
+
+	items, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	names = make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name())
+	}
+
+	s.lock.Lock()
+	if s.entries == nil || len(s.entries) >= foldCacheMaxEntries {
+		s.entries = map[string]foldEntry{}
+	}
+	s.entries[dir] = foldEntry{
+		modTime: info.ModTime(),
+		names:   names,
+	}
+	s.lock.Unlock()
+
+	return
+}
+
+func caseCollisions(items []Item) (names []string) {
+	seen := map[string][]string{}
+	for _, item := range items {
+		key := strings.ToLower(item.Name)
+		seen[key] = append(seen[key], item.Name)
+	}
+
+	for _, group := range seen {
+		if len(group) > 1 {
+			names = append(names, group...)
+		}
+	}
+	sort.Strings(names)
+
+	return
+}
+
+func (h *StaticHandler) foldPath(reqPath string) (folded string, ok bool) {
+	parts := strings.Split(strings.Trim(
+		filepath.ToSlash(filepath.Clean("/"+reqPath)), "/"), "/")
+
+	relPath := ""
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+
+		exists, err := Exists(h.resolvePath(relPath + "/" + part))
+		if err != nil {
+			return
+		}
+		if exists {
+			relPath += "/" + part
+			continue
+		}
+
+		matches := []string{}
+		for _, root := range h.roots() {
+			names, e := h.folds.Names(
+				filepath.Join(root, filepath.FromSlash(relPath)))
+			if e != nil {
+				continue
+			}
+			for _, name := range names {
+				if strings.EqualFold(name, part) {
+					matches = append(matches, name)
+					break
+				}
+			}
+		}
+		if len(matches) == 0 {
+			return
+		}
+		sort.Strings(matches)
+
+		relPath += "/" + matches[0]
+	}
+
+	folded = relPath
+	if strings.HasSuffix(reqPath, "/") {
+		folded += "/"
+	}
+	ok = true
+	return
+}
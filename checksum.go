@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var hashFuncs = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+type checksumKey struct {
+	path string
+	algo string
+}
+
+type checksumEntry struct {
+	modTime time.Time
+	size    int64
+	sum     []byte
+}
+
+type checksumCache struct {
+	lock    sync.Mutex
+	entries map[checksumKey]checksumEntry
+}
+
+func (s *checksumCache) Sum(path string, algo string, info os.FileInfo) (
+	sum []byte, err error) {
+
+	key := checksumKey{
+		path: path,
+		algo: algo,
+	}
+
+	s.lock.Lock()
+	entry, ok := s.entries[key]
+	s.lock.Unlock()
+
+	if ok && entry.modTime.Equal(info.ModTime()) &&
+		entry.size == info.Size() {
+
+		sum = entry.sum
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	hsh := hashFuncs[algo]()
+	_, err = io.Copy(hsh, file)
+	if err != nil {
+		return
+	}
+	sum = hsh.Sum(nil)
+
+	s.lock.Lock()
+	if s.entries == nil {
+		s.entries = map[checksumKey]checksumEntry{}
+	}
+	s.entries[key] = checksumEntry{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		sum:     sum,
+	}
+	s.lock.Unlock()
+
+	return
+}
+
+func (h *StaticHandler) HandleChecksum(path string, c *gin.Context) (
+	ok bool, err error) {
+
+	algo := c.Query("checksum")
+	if algo == "" {
+		exists, e := Exists(path)
+		if e != nil || exists {
+			err = e
+			return
+		}
+
+		for name := range hashFuncs {
+			if strings.HasSuffix(path, "."+name) {
+				algo = name
+				path = strings.TrimSuffix(path, "."+name)
+				break
+			}
+		}
+		if algo == "" {
+			return
+		}
+	} else if hashFuncs[algo] == nil {
+		ok = true
+		c.AbortWithStatus(400)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	err = h.verifyFile(path)
+	if err != nil {
+		return
+	}
+	if info.IsDir() || !h.ownedBy(info) {
+		return
+	}
+
+	ok = true
+	writer, release, allowed := h.fileWriter(c)
+	defer release()
+	if !allowed {
+		return
+	}
+
+	sum, err := h.checksums.Sum(path, algo, info)
+	if err != nil {
+		return
+	}
+
+	data := []byte(fmt.Sprintf("%s  %s\n",
+		hex.EncodeToString(sum), filepath.Base(path)))
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(writer, c.Request, filepath.Base(path)+"."+algo,
+		info.ModTime(), bytes.NewReader(data))
+
+	return
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var redactedFlags = []string{
+	"key",
+	"password",
+	"secret",
+	"ticket",
+	"token",
+}
+
+type debugConfig struct {
+	Root     string            `json:"root"`
+	Overlays []string          `json:"overlays"`
+	Flags    map[string]string `json:"flags"`
+}
+
+func redactFlag(f *flag.Flag) string {
+	value := f.Value.String()
+	if value == "" {
+		return value
+	}
+
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	if ok && boolFlag.IsBoolFlag() {
+		return value
+	}
+
+	for _, sensitive := range redactedFlags {
+		if strings.Contains(f.Name, sensitive) {
+			return "REDACTED"
+		}
+	}
+	return value
+}
+
+func debugConfigHandler(static *StaticHandler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			w.WriteHeader(405)
+			return
+		}
+
+		conf := &debugConfig{
+			Root:     static.Root,
+			Overlays: static.Overlays,
+			Flags:    map[string]string{},
+		}
+		flag.VisitAll(func(f *flag.Flag) {
+			conf.Flags[f.Name] = redactFlag(f)
+		})
+
+		data, err := json.MarshalIndent(conf, "", "  ")
+		if err != nil {
+			w.WriteHeader(500)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(append(data, '\n'))
+	})
+	return mux
+}
+
+func serveDebugConfig(addr string, static *StaticHandler) (err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		err := http.Serve(listener, debugConfigHandler(static))
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var digestAlgos = map[string]string{
+	"md5":     "md5",
+	"sha":     "sha1",
+	"sha-256": "sha256",
+	"sha-512": "sha512",
+}
+
+func wantDigest(header string, fallback string) (algo string) {
+	best := 0.0
+	for _, want := range strings.Split(header, ",") {
+		params := strings.Split(want, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if digestAlgos[name] == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				val, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = val
+				}
+			}
+		}
+
+		if q > best {
+			best = q
+			algo = name
+		}
+	}
+
+	if algo == "" {
+		algo = fallback
+	}
+	return
+}
+
+func (h *StaticHandler) setDigest(path string, info os.FileInfo,
+	c *gin.Context) (err error) {
+
+	algo := wantDigest(c.Request.Header.Get("Want-Digest"), h.Digest)
+
+	sum, err := h.checksums.Sum(path, digestAlgos[algo], info)
+	if err != nil {
+		return
+	}
+
+	c.Writer.Header().Set("Digest",
+		algo+"="+base64.StdEncoding.EncodeToString(sum))
+	return
+}
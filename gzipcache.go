@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+)
+
+const gzipCacheMaxEntries = 1024
+
+type gzipEntry struct {
+	stamp string
+	data  []byte
+	gzip  []byte
+}
+
+type gzipCache struct {
+	lock    sync.Mutex
+	entries map[string]gzipEntry
+}
+
+func (s *gzipCache) Get(path string, stamp string) (entry gzipEntry,
+	ok bool) {
+
+	s.lock.Lock()
+	entry, ok = s.entries[path]
+	s.lock.Unlock()
+
+	if !ok || entry.stamp != stamp {
+		ok = false
+		return
+	}
+
+	return
+}
+
+func (s *gzipCache) Put(path string, entry gzipEntry) {
+	s.lock.Lock()
+	if s.entries == nil || len(s.entries) >= gzipCacheMaxEntries {
+		s.entries = map[string]gzipEntry{}
+	}
+	s.entries[path] = entry
+	s.lock.Unlock()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type language struct {
+	tag string
+	q   float64
+}
+
+func acceptedLanguages(header string) (tags []string) {
+	langs := []language{}
+
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				val, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					q = val
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		langs = append(langs, language{
+			tag: tag,
+			q:   q,
+		})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	seen := map[string]bool{}
+	for _, lang := range langs {
+		candidates := []string{lang.tag}
+		if i := strings.Index(lang.tag, "-"); i > 0 {
+			candidates = append(candidates, lang.tag[:i])
+		}
+
+		for _, tag := range candidates {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return
+}
+
+func (h *StaticHandler) HandleLocalizedIndex(path string, c *gin.Context) (
+	ok bool, err error) {
+
+	c.Writer.Header().Add("Vary", "Accept-Language")
+
+	for _, tag := range acceptedLanguages(
+		c.Request.Header.Get("Accept-Language")) {
+
+		if strings.ContainsAny(tag, `/\.`) {
+			continue
+		}
+
+		index := filepath.Join(path, "index."+tag+".html")
+		exists, e := h.ownedExists(index)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if exists {
+			err = h.verifyFile(index)
+			if err != nil {
+				return
+			}
+
+			ok = true
+			c.Writer.Header().Set("Content-Language", tag)
+			if h.CSP != "" {
+				c.Writer.Header().Set("Content-Security-Policy", h.CSP)
+			}
+			if len(h.Preload) > 0 {
+				h.preloadLinks(c)
+			}
+
+			if h.LiveReload {
+				served, e := h.serveLiveReloadHTML(index, c)
+				if e != nil || served {
+					err = e
+					return
+				}
+			}
+
+			writer, release, allowed := h.fileWriter(c)
+			defer release()
+			if !allowed {
+				return
+			}
+
+			http.ServeFile(writer, c.Request, index)
+			return
+		}
+	}
+
+	return
+}
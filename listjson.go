@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type jsonItem struct {
+	Name     string    `json:"name"`
+	IsDir    bool      `json:"is_dir"`
+	ModTime  time.Time `json:"mod_time"`
+	Size     *int64    `json:"size,omitempty"`
+	Category string    `json:"category"`
+}
+
+type jsonListing struct {
+	Path      string     `json:"path"`
+	Parent    string     `json:"parent,omitempty"`
+	Items     []jsonItem `json:"items"`
+	Total     int        `json:"total"`
+	Truncated bool       `json:"truncated"`
+}
+
+func (h *StaticHandler) HandleDirJSON(pathFrm string, items *Items,
+	total int, c *gin.Context) (err error) {
+
+	listing := &jsonListing{
+		Path:      pathFrm,
+		Items:     []jsonItem{},
+		Total:     total,
+		Truncated: total > items.Len(),
+	}
+	if pathFrm != "/" {
+		listing.Parent = path.Dir(strings.TrimSuffix(pathFrm, "/"))
+		if listing.Parent != "/" {
+			listing.Parent += "/"
+		}
+	}
+
+	for _, item := range items.items {
+		itm := jsonItem{
+			Name:     item.Name,
+			IsDir:    item.IsDir,
+			ModTime:  item.ModTime.UTC(),
+			Category: item.Category,
+		}
+		if !item.IsDir && h.HideSizes == "" {
+			size := item.Size
+			itm.Size = &size
+		}
+		listing.Items = append(listing.Items, itm)
+	}
+
+	data, err := json.MarshalIndent(listing, "", "  ")
+	if err != nil {
+		return
+	}
+
+	c.Data(200, "application/json; charset=utf-8", append(data, '\n'))
+
+	return
+}
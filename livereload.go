@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const liveReloadPath = "/__livereload"
+
+const liveReloadScript = `<script%s>
+(function() {
+	var proto = location.protocol === "https:" ? "wss://" : "ws://";
+	var sock = new WebSocket(proto + location.host + "%s");
+	sock.onmessage = function() {
+		location.reload();
+	};
+})();
+</script>
+`
+
+type liveReload struct {
+	lock     sync.Mutex
+	clients  map[chan struct{}]bool
+	watcher  *fsnotify.Watcher
+	upgrader websocket.Upgrader
+	roots    []string
+	maxDepth int
+}
+
+func (l *liveReload) tooDeep(path string) bool {
+	if l.maxDepth <= 0 {
+		return false
+	}
+
+	for _, root := range l.roots {
+		relPath, err := filepath.Rel(root, path)
+		if err == nil && !strings.HasPrefix(relPath, "..") {
+			return pathDepth(relPath) >= l.maxDepth
+		}
+	}
+	return false
+}
+
+func (l *liveReload) addDirs(root string) (err error) {
+	err = filepath.Walk(root, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			if os.IsPermission(err) || os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			if path == root {
+				return l.watcher.Add(path)
+			}
+			return nil
+		}
+		if path != root && vcsDirs[info.Name()] || l.tooDeep(path) {
+			return filepath.SkipDir
+		}
+		return l.watcher.Add(path)
+	})
+	return
+}
+
+func (l *liveReload) broadcast() {
+	l.lock.Lock()
+	for client := range l.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+	l.lock.Unlock()
+}
+
+func (l *liveReload) Watch(roots []string) (err error) {
+	l.clients = map[chan struct{}]bool{}
+	l.roots = roots
+
+	l.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+
+	for _, root := range roots {
+		err = l.addDirs(root)
+		if err != nil {
+			l.watcher.Close()
+			return
+		}
+	}
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case evt, ok := <-l.watcher.Events:
+				if !ok {
+					return
+				}
+
+				if evt.Op&fsnotify.Create != 0 {
+					isDir, _ := IsDirectory(evt.Name)
+					if isDir {
+						l.addDirs(evt.Name)
+					}
+				}
+
+				if timer == nil {
+					timer = time.AfterFunc(100*time.Millisecond, l.broadcast)
+				} else {
+					timer.Reset(100 * time.Millisecond)
+				}
+			case err, ok := <-l.watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(gin.DefaultErrorWriter,
+					"[WARN] %s | live reload watcher | %v\n",
+					time.Now().Format("2006/01/02 - 15:04:05"), err)
+			}
+		}
+	}()
+
+	return
+}
+
+func (l *liveReload) Handle(c *gin.Context) {
+	conn, err := l.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	client := make(chan struct{}, 1)
+	l.lock.Lock()
+	l.clients[client] = true
+	l.lock.Unlock()
+
+	defer func() {
+		l.lock.Lock()
+		delete(l.clients, client)
+		l.lock.Unlock()
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-client:
+			err = conn.WriteMessage(websocket.TextMessage, []byte("reload"))
+			if err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func injectLiveReload(data []byte, nonceAttr string) []byte {
+	script := []byte(fmt.Sprintf(liveReloadScript, nonceAttr,
+		liveReloadPath))
+
+	index := bytes.LastIndex(bytes.ToLower(data), []byte("</body>"))
+	if index < 0 {
+		return append(data, script...)
+	}
+
+	injected := make([]byte, 0, len(data)+len(script))
+	injected = append(injected, data[:index]...)
+	injected = append(injected, script...)
+	injected = append(injected, data[index:]...)
+	return injected
+}
+
+func (h *StaticHandler) serveLiveReloadHTML(path string, c *gin.Context) (
+	ok bool, err error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if info.IsDir() {
+		return
+	}
+
+	err = h.verifyFile(path)
+	if err != nil {
+		return
+	}
+
+	ok = true
+	writer, release, allowed := h.fileWriter(c)
+	defer release()
+	if !allowed {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	modTime := info.ModTime()
+	nonceAttr := ""
+	if h.CSP != "" && h.CSPNonce {
+		nonce, e := randNonce()
+		if e != nil {
+			err = e
+			return
+		}
+		c.Writer.Header().Set("Content-Security-Policy",
+			cspWithNonce(h.CSP, nonce))
+		nonceAttr = fmt.Sprintf(` nonce="%s"`, nonce)
+		modTime = time.Time{}
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(writer, c.Request, info.Name(), modTime,
+		bytes.NewReader(injectLiveReload(data, nonceAttr)))
+
+	return
+}
@@ -1,39 +1,354 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
+	"html/template"
 	"io/ioutil"
+	"math"
 	"math/big"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
 )
 
 const body = `<html>
-<head><title>Index of %s</title></head>
+<head><title>%s</title></head>
 <body bgcolor="white">
-<h1>Index of %s</h1><hr><pre><a href="../">../</a>
-%s</pre><hr></body>
+<h1>%s</h1><hr>%s<pre><a href="../">../</a>
+%s</pre><hr>%s%s</body>
 </html>
 `
 
+const filterScript = `<script%s>
+(function() {
+	var pre = document.getElementsByTagName("pre")[0];
+	var items = pre.querySelectorAll("span[data-name]");
+	var input = document.createElement("input");
+	input.type = "search";
+	input.placeholder = "Filter";
+	input.oninput = function() {
+		var query = input.value.toLowerCase();
+		for (var i = 0; i < items.length; i++) {
+			var name = items[i].getAttribute("data-name").toLowerCase();
+			items[i].style.display = name.indexOf(query) === -1 ? "none" : "";
+		}
+	};
+	pre.parentNode.insertBefore(input, pre);
+})();
+</script>
+`
+
+var mimeTypes = map[string]string{
+	".webmanifest": "application/manifest+json",
+	".mjs":         "text/javascript; charset=utf-8",
+	".avif":        "image/avif",
+	".webp":        "image/webp",
+}
+
+func initMime() (err error) {
+	for ext, typ := range mimeTypes {
+		err = mime.AddExtensionType(ext, typ)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func parseCacheRules(rules []string) (
+	cacheRules map[string]string, err error) {
+
+	cacheRules = map[string]string{}
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("invalid cache rule %s", rule)
+			return
+		}
+
+		ext := strings.ToLower(strings.TrimSpace(parts[0]))
+		if ext != "*" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+
+		directives := strings.Split(parts[1], ",")
+		maxAge, e := strconv.Atoi(strings.TrimSpace(directives[0]))
+		if e != nil || maxAge < 0 {
+			err = fmt.Errorf("invalid max-age in cache rule %s", rule)
+			return
+		}
+
+		control := fmt.Sprintf("max-age=%d", maxAge)
+		for _, directive := range directives[1:] {
+			directive = strings.TrimSpace(directive)
+			if directive != "" {
+				control += ", " + directive
+			}
+		}
+		cacheRules[ext] = control
+	}
+
+	return
+}
+
+type PreloadRule struct {
+	Pattern string
+	Link    string
+}
+
+func parsePreloadRules(rules []string) (
+	preloadRules []PreloadRule, err error) {
+
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			err = fmt.Errorf("invalid preload rule %s", rule)
+			return
+		}
+
+		pattern := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(pattern, "/") {
+			pattern = "/" + pattern
+		}
+
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			err = fmt.Errorf("invalid pattern in preload rule %s", rule)
+			return
+		}
+
+		preloadRules = append(preloadRules, PreloadRule{
+			Pattern: pattern,
+			Link:    strings.TrimSpace(parts[1]),
+		})
+	}
+
+	return
+}
+
+type RewriteRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func parseRewriteRules(rules []string) (
+	rewriteRules []RewriteRule, err error) {
+
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			err = fmt.Errorf("invalid rewrite rule %s", rule)
+			return
+		}
+
+		pattern, e := regexp.Compile(parts[0])
+		if e != nil {
+			err = fmt.Errorf("invalid pattern in rewrite rule %s: %w",
+				rule, e)
+			return
+		}
+
+		rewriteRules = append(rewriteRules, RewriteRule{
+			Pattern:     pattern,
+			Replacement: parts[1],
+		})
+	}
+
+	return
+}
+
+func randNonce() (nonce string, err error) {
+	nonceByt := make([]byte, 16)
+	_, err = rand.Read(nonceByt)
+	if err != nil {
+		return
+	}
+
+	nonce = base64.StdEncoding.EncodeToString(nonceByt)
+	return
+}
+
+func randPadding(size int) (padding string, err error) {
+	paddingByt := make([]byte, size)
+	_, err = rand.Read(paddingByt)
+	if err != nil {
+		return
+	}
+
+	padding = base64.RawURLEncoding.EncodeToString(paddingByt)[:size]
+	return
+}
+
+func randId() (id string, err error) {
+	idByt := make([]byte, 8)
+	_, err = rand.Read(idByt)
+	if err != nil {
+		return
+	}
+
+	id = hex.EncodeToString(idByt)
+	return
+}
+
+func cspWithNonce(policy string, nonce string) string {
+	source := fmt.Sprintf("'nonce-%s'", nonce)
+
+	directives := strings.Split(policy, ";")
+	for i, directive := range directives {
+		fields := strings.Fields(directive)
+		if len(fields) > 0 && strings.ToLower(fields[0]) == "script-src" {
+			directives[i] = strings.TrimRight(directive, " ") + " " + source
+			return strings.Join(directives, ";")
+		}
+	}
+
+	return strings.TrimRight(policy, "; ") + "; script-src " + source
+}
+
+func parseCompressLevel(value string) (level int, err error) {
+	switch value {
+	case "", "default":
+		level = gzip.DefaultCompression
+	case "best-speed":
+		level = gzip.BestSpeed
+	case "best-compression":
+		level = gzip.BestCompression
+	default:
+		level, err = strconv.Atoi(value)
+		if err != nil || level < gzip.BestSpeed ||
+			level > gzip.BestCompression {
+
+			err = fmt.Errorf("invalid compression level %s", value)
+			return
+		}
+	}
+
+	return
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(
+		r.Header.Get("Accept-Encoding"), ",") {
+
+		params := strings.Split(encoding, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func safePath(pth string) bool {
+	for _, char := range pth {
+		if char < 0x20 || char == 0x7f {
+			return false
+		}
+	}
+	return !unsafeOSPath(pth)
+}
+
+var vcsDirs = map[string]bool{
+	".bzr": true,
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+var errSymlinkDepth = errors.New("symlink depth limit exceeded")
+
+func resolveSymlink(path string, maxDepth int) (
+	info os.FileInfo, err error) {
+
+	for depth := 0; ; depth++ {
+		if depth >= maxDepth {
+			err = errSymlinkDepth
+			return
+		}
+
+		target, e := os.Readlink(path)
+		if e != nil {
+			err = e
+			return
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+
+		info, err = os.Lstat(target)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return
+		}
+		path = target
+	}
+}
+
+func notExist(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ELOOP)
+}
+
 func IsDirectory(path string) (dir bool, err error) {
 	stat, err := os.Stat(path)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if notExist(err) {
 			err = nil
 		}
 		return
@@ -43,14 +358,123 @@ func IsDirectory(path string) (dir bool, err error) {
 	return
 }
 
+func Exists(path string) (exists bool, err error) {
+	_, err = os.Stat(path)
+	if err != nil {
+		if notExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	exists = true
+	return
+}
+
+func timeAgo(t time.Time, now time.Time) string {
+	elapsed := now.Sub(t)
+
+	count := 0
+	unit := ""
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		count, unit = int(elapsed/time.Minute), "minute"
+	case elapsed < 24*time.Hour:
+		count, unit = int(elapsed/time.Hour), "hour"
+	case elapsed < 30*24*time.Hour:
+		count, unit = int(elapsed/(24*time.Hour)), "day"
+	case elapsed < 365*24*time.Hour:
+		count, unit = int(elapsed/(30*24*time.Hour)), "month"
+	default:
+		count, unit = int(elapsed/(365*24*time.Hour)), "year"
+	}
+
+	if count != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s ago", count, unit)
+}
+
+func sizeCategory(size int64) string {
+	if size < 1<<20 {
+		return "small"
+	} else if size < 100<<20 {
+		return "medium"
+	}
+	return "large"
+}
+
+var categories = []string{
+	"Folders",
+	"Images",
+	"Videos",
+	"Documents",
+	"Other",
+}
+
+var categoryExts = map[string]string{
+	".avif": "Images",
+	".bmp":  "Images",
+	".gif":  "Images",
+	".ico":  "Images",
+	".jpeg": "Images",
+	".jpg":  "Images",
+	".png":  "Images",
+	".svg":  "Images",
+	".tif":  "Images",
+	".tiff": "Images",
+	".webp": "Images",
+	".avi":  "Videos",
+	".m4v":  "Videos",
+	".mkv":  "Videos",
+	".mov":  "Videos",
+	".mp4":  "Videos",
+	".mpeg": "Videos",
+	".mpg":  "Videos",
+	".webm": "Videos",
+	".csv":  "Documents",
+	".doc":  "Documents",
+	".docx": "Documents",
+	".epub": "Documents",
+	".md":   "Documents",
+	".odp":  "Documents",
+	".ods":  "Documents",
+	".odt":  "Documents",
+	".pdf":  "Documents",
+	".ppt":  "Documents",
+	".pptx": "Documents",
+	".rtf":  "Documents",
+	".txt":  "Documents",
+	".xls":  "Documents",
+	".xlsx": "Documents",
+}
+
+func category(name string, isDir bool) string {
+	if isDir {
+		return "Folders"
+	}
+
+	category, ok := categoryExts[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return "Other"
+	}
+	return category
+}
+
 type Item struct {
 	Name      string
 	IsDir     bool
+	ModTime   time.Time
+	Size      int64
+	Category  string
 	Formatted string
 }
 
 type Items struct {
-	items []Item
+	Natural bool
+	items   []Item
 }
 
 func (s *Items) Len() (n int) {
@@ -74,9 +498,54 @@ func (s *Items) Less(i int, j int) bool {
 		return false
 	}
 
+	if s.Natural {
+		return naturalLess(s.items[i].Name, s.items[j].Name)
+	}
 	return s.items[i].Name < s.items[j].Name
 }
 
+func naturalLess(a string, b string) bool {
+	i := 0
+	j := 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			iStart := i
+			jStart := j
+			for i < len(a) && isDigit(a[i]) {
+				i += 1
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j += 1
+			}
+
+			iNum := strings.TrimLeft(a[iStart:i], "0")
+			jNum := strings.TrimLeft(b[jStart:j], "0")
+			if len(iNum) != len(jNum) {
+				return len(iNum) < len(jNum)
+			}
+			if iNum != jNum {
+				return iNum < jNum
+			}
+			continue
+		}
+
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i += 1
+		j += 1
+	}
+
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
 func (s *Items) Swap(i int, j int) {
 	s.items[i], s.items[j] = s.items[j], s.items[i]
 }
@@ -85,233 +554,3056 @@ func (s *Items) Add(item Item) {
 	s.items = append(s.items, item)
 }
 
+func (s *Items) Truncate(n int) {
+	if n < len(s.items) {
+		s.items = s.items[:n]
+	}
+}
+
 func (s *Items) Sort() {
 	sort.Sort(s)
 }
 
-func (s *Items) Join(sep string) (data string) {
-	for i, item := range s.items {
-		if i != 0 {
-			data += sep
+func (s *Items) Join(sep string) (data string) {
+	for i, item := range s.items {
+		if i != 0 {
+			data += sep
+		}
+		data += item.Formatted
+	}
+	return
+}
+
+type Maintenance struct {
+	RetryAfter int
+	enabled    int32
+}
+
+func (m *Maintenance) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+func (m *Maintenance) Toggle() (enabled bool) {
+	for {
+		cur := atomic.LoadInt32(&m.enabled)
+		if atomic.CompareAndSwapInt32(&m.enabled, cur, cur^1) {
+			enabled = cur == 0
+			return
+		}
+	}
+}
+
+func (m *Maintenance) Handle(c *gin.Context) {
+	if !m.Enabled() {
+		return
+	}
+
+	c.Writer.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+	c.AbortWithStatus(503)
+}
+
+type InFlight struct {
+	requests int64
+	conns    int64
+}
+
+func (f *InFlight) Handle(c *gin.Context) {
+	atomic.AddInt64(&f.requests, 1)
+	defer atomic.AddInt64(&f.requests, -1)
+
+	c.Next()
+}
+
+func (f *InFlight) ConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&f.conns, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&f.conns, -1)
+	}
+}
+
+func (f *InFlight) Requests() int64 {
+	return atomic.LoadInt64(&f.requests)
+}
+
+func (f *InFlight) Conns() int64 {
+	return atomic.LoadInt64(&f.conns)
+}
+
+type HealthCheck struct {
+	Path     string
+	Warmup   *Warmup
+	InFlight *InFlight
+}
+
+func (h *HealthCheck) Handle(c *gin.Context) {
+	if c.Request.URL.Path != h.Path ||
+		c.Request.Method != "GET" && c.Request.Method != "HEAD" {
+
+		return
+	}
+
+	c.Writer.Header().Set("Cache-Control", "no-store")
+	if h.InFlight != nil {
+		c.Writer.Header().Set("X-In-Flight",
+			strconv.FormatInt(h.InFlight.Requests(), 10))
+	}
+	if h.Warmup != nil && !h.Warmup.Ready() {
+		c.Writer.Header().Set("Retry-After",
+			strconv.Itoa(h.Warmup.RetryAfter))
+		c.String(503, "warming up\n")
+		c.Abort()
+		return
+	}
+
+	c.String(200, "ok\n")
+	c.Abort()
+}
+
+type AccessLogger struct {
+	Sample   uint64
+	Vhost    bool
+	FilePath bool
+	TLS      bool
+	count    uint64
+}
+
+func (l *AccessLogger) Format(param gin.LogFormatterParams) string {
+	if l.Sample > 1 && param.StatusCode < 400 &&
+		atomic.AddUint64(&l.count, 1)%l.Sample != 1 {
+
+		return ""
+	}
+
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	prefix := ""
+	if l.Vhost {
+		host := param.Request.Host
+		if host == "" {
+			host = "-"
+		}
+		prefix = host + " "
+	}
+
+	suffix := ""
+	if l.FilePath {
+		if filePath, ok := param.Keys["filepath"].(string); ok {
+			suffix = " | " + filePath
+		}
+	}
+	if l.TLS && param.Request.TLS != nil {
+		state := param.Request.TLS
+		suffix += fmt.Sprintf(" | %s %s sni=%s alpn=%s",
+			tls.VersionName(state.Version),
+			tls.CipherSuiteName(state.CipherSuite),
+			state.ServerName, state.NegotiatedProtocol)
+	}
+
+	return prefix + fmt.Sprintf(
+		"[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v%s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		param.Path,
+		suffix,
+		param.ErrorMessage,
+	)
+}
+
+type SlowLogger struct {
+	Threshold time.Duration
+}
+
+func (l *SlowLogger) Handle(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	latency := time.Since(start)
+
+	if latency > l.Threshold {
+		fmt.Fprintf(gin.DefaultWriter,
+			"[WARN] %s | slow request | %13v | %-7s %#v\n",
+			start.Format("2006/01/02 - 15:04:05"), latency,
+			c.Request.Method, c.Request.URL.Path)
+	}
+}
+
+type Warmup struct {
+	RetryAfter int
+	ready      int32
+}
+
+func (w *Warmup) Start(duration time.Duration) {
+	time.AfterFunc(duration, func() {
+		atomic.StoreInt32(&w.ready, 1)
+		fmt.Println("Warmup complete")
+	})
+}
+
+func (w *Warmup) Ready() bool {
+	return atomic.LoadInt32(&w.ready) == 1
+}
+
+func (w *Warmup) Handle(c *gin.Context) {
+	if w.Ready() {
+		return
+	}
+
+	c.Writer.Header().Set("Retry-After", strconv.Itoa(w.RetryAfter))
+	c.AbortWithStatus(503)
+}
+
+type noDelayListener struct {
+	net.Listener
+	noDelay bool
+}
+
+func (l *noDelayListener) Accept() (conn net.Conn, err error) {
+	conn, err = l.Listener.Accept()
+	if err != nil {
+		return
+	}
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if ok {
+		_ = tcpConn.SetNoDelay(l.noDelay)
+	}
+
+	return
+}
+
+func optionsAsterisk(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" && r.RequestURI == "*" {
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			w.Header().Set("Content-Length", "0")
+			w.WriteHeader(200)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+type CanonicalHost struct {
+	Host string
+}
+
+func (h *CanonicalHost) Handle(c *gin.Context) {
+	host := c.Request.Host
+	canonical := h.Host
+
+	_, _, err := net.SplitHostPort(canonical)
+	if err != nil {
+		hostname, port, e := net.SplitHostPort(host)
+		if e == nil {
+			host = hostname
+			canonical = net.JoinHostPort(canonical, port)
+		}
+	}
+
+	if strings.EqualFold(host, h.Host) {
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	c.Redirect(301, scheme+"://"+canonical+c.Request.URL.RequestURI())
+	c.Abort()
+}
+
+type PathLimit struct {
+	MaxLen int
+}
+
+func (l *PathLimit) Handle(c *gin.Context) {
+	if len(c.Request.URL.Path) > l.MaxLen {
+		c.AbortWithStatus(414)
+	}
+}
+
+type SecurityHeaders struct {
+	Headers map[string]string
+}
+
+func (s *SecurityHeaders) Handle(c *gin.Context) {
+	for key, val := range s.Headers {
+		c.Writer.Header().Set(key, val)
+	}
+}
+
+func SafeRecovery(c *gin.Context) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		if rec == http.ErrAbortHandler {
+			panic(rec)
+		}
+
+		requestId, err := randId()
+		if err != nil {
+			requestId = "unknown"
+		}
+
+		fmt.Fprintf(gin.DefaultErrorWriter,
+			"[ERROR] %s | internal error | request_id=%s | %-7s %#v\n",
+			time.Now().Format("2006/01/02 - 15:04:05"), requestId,
+			c.Request.Method, c.Request.URL.Path)
+		if gin.IsDebugging() {
+			fmt.Fprintf(gin.DefaultErrorWriter,
+				"[DEBUG] request_id=%s | panic: %v\n%s",
+				requestId, rec, debug.Stack())
+		}
+
+		c.AbortWithStatus(500)
+	}()
+
+	c.Next()
+}
+
+type FileLimiter struct {
+	Reject     bool
+	RetryAfter int
+	sem        chan struct{}
+}
+
+func (l *FileLimiter) Acquire(c *gin.Context) bool {
+	if l.Reject {
+		select {
+		case l.sem <- struct{}{}:
+			return true
+		default:
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(l.RetryAfter))
+			c.AbortWithStatus(503)
+			return false
+		}
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-c.Request.Context().Done():
+		c.Abort()
+		return false
+	}
+}
+
+func (l *FileLimiter) Release() {
+	<-l.sem
+}
+
+type ConnLimiter struct {
+	Max        int
+	RetryAfter int
+	lock       sync.Mutex
+	conns      map[string]int
+}
+
+func (l *ConnLimiter) Handle(c *gin.Context) {
+	ip := c.RemoteIP()
+
+	l.lock.Lock()
+	if l.conns == nil {
+		l.conns = map[string]int{}
+	}
+	if l.conns[ip] >= l.Max {
+		l.lock.Unlock()
+		c.Writer.Header().Set("Retry-After", strconv.Itoa(l.RetryAfter))
+		c.AbortWithStatus(503)
+		return
+	}
+	l.conns[ip] += 1
+	l.lock.Unlock()
+
+	defer func() {
+		l.lock.Lock()
+		l.conns[ip] -= 1
+		if l.conns[ip] <= 0 {
+			delete(l.conns, ip)
+		}
+		l.lock.Unlock()
+	}()
+
+	c.Next()
+}
+
+type Rewriter struct {
+	Rules []RewriteRule
+}
+
+func (r *Rewriter) Handle(c *gin.Context) {
+	reqPath := c.Request.URL.Path
+	for _, rule := range r.Rules {
+		if !rule.Pattern.MatchString(reqPath) {
+			continue
+		}
+
+		result := rule.Pattern.ReplaceAllString(reqPath, rule.Replacement)
+		rewritten := path.Clean("/" + result)
+		if strings.HasSuffix(result, "/") && rewritten != "/" {
+			rewritten += "/"
+		}
+
+		c.Request.URL.Path = rewritten
+		c.Request.URL.RawPath = ""
+		for i := range c.Params {
+			if c.Params[i].Key == "filepath" {
+				c.Params[i].Value = rewritten
+			}
+		}
+		return
+	}
+}
+
+type Quota struct {
+	Limit      uint64
+	Reset      time.Duration
+	RetryAfter int
+	used       uint64
+	resetAt    int64
+}
+
+func (q *Quota) Start() {
+	if q.Reset <= 0 {
+		return
+	}
+
+	atomic.StoreInt64(&q.resetAt, time.Now().Add(q.Reset).UnixNano())
+	go func() {
+		ticker := time.NewTicker(q.Reset)
+		for now := range ticker.C {
+			atomic.StoreInt64(&q.resetAt, now.Add(q.Reset).UnixNano())
+			atomic.StoreUint64(&q.used, 0)
+		}
+	}()
+}
+
+func (q *Quota) Handle(c *gin.Context) {
+	c.Next()
+
+	if c.GetBool("quotaCounted") {
+		return
+	}
+
+	size := c.Writer.Size()
+	if size > 0 {
+		atomic.AddUint64(&q.used, uint64(size))
+	}
+}
+
+func (q *Quota) Reserve(size int) (allowed int) {
+	for {
+		used := atomic.LoadUint64(&q.used)
+		if used >= q.Limit {
+			return
+		}
+
+		allowed = size
+		if remaining := q.Limit - used; uint64(size) > remaining {
+			allowed = int(remaining)
+		}
+		if atomic.CompareAndSwapUint64(&q.used, used,
+			used+uint64(allowed)) {
+
+			return
+		}
+	}
+}
+
+func (q *Quota) Allow(c *gin.Context) bool {
+	if atomic.LoadUint64(&q.used) < q.Limit {
+		return true
+	}
+
+	retryAfter := q.RetryAfter
+	resetAt := atomic.LoadInt64(&q.resetAt)
+	if resetAt != 0 {
+		retryAfter = int(math.Ceil(
+			time.Until(time.Unix(0, resetAt)).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+	}
+
+	c.Writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatus(503)
+	return false
+}
+
+var errQuotaExceeded = errors.New("bandwidth quota exceeded")
+
+type quotaWriter struct {
+	http.ResponseWriter
+	quota *Quota
+}
+
+func (w *quotaWriter) Write(data []byte) (n int, err error) {
+	allowed := w.quota.Reserve(len(data))
+	n, err = w.ResponseWriter.Write(data[:allowed])
+	if err == nil && allowed < len(data) {
+		err = errQuotaExceeded
+	}
+	return
+}
+
+type jsonErrorWriter struct {
+	gin.ResponseWriter
+	failed bool
+}
+
+func (w *jsonErrorWriter) WriteHeader(code int) {
+	if code >= 400 {
+		w.failed = true
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *jsonErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *jsonErrorWriter) Write(data []byte) (n int, err error) {
+	if w.failed {
+		n = len(data)
+		return
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *jsonErrorWriter) WriteString(data string) (n int, err error) {
+	if w.failed {
+		n = len(data)
+		return
+	}
+	return w.ResponseWriter.WriteString(data)
+}
+
+func JSONErrors(c *gin.Context) {
+	writer := &jsonErrorWriter{
+		ResponseWriter: c.Writer,
+	}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	if !writer.failed || c.Request.Method == "HEAD" {
+		return
+	}
+
+	status := writer.Status()
+	data, err := json.Marshal(map[string]interface{}{
+		"error":  http.StatusText(status),
+		"status": status,
+	})
+	if err != nil {
+		return
+	}
+	writer.ResponseWriter.Write(append(data, '\n'))
+}
+
+type maskForbiddenWriter struct {
+	http.ResponseWriter
+	masked bool
+}
+
+func (w *maskForbiddenWriter) WriteHeader(code int) {
+	if code == 403 {
+		w.masked = true
+		code = 404
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *maskForbiddenWriter) Write(data []byte) (n int, err error) {
+	if w.masked {
+		n = len(data)
+		return
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+type connRate struct {
+	lock   sync.Mutex
+	tokens int
+	last   time.Time
+	refs   int
+}
+
+func (r *connRate) Reserve(size int, rate int, burst int) (
+	wait time.Duration) {
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if r.last.IsZero() {
+		r.tokens = burst
+	} else {
+		r.tokens += int(now.Sub(r.last).Seconds() * float64(rate))
+		if r.tokens > burst {
+			r.tokens = burst
+		}
+	}
+	r.last = now
+
+	r.tokens -= size
+	if r.tokens < 0 {
+		wait = time.Duration(float64(-r.tokens) / float64(rate) *
+			float64(time.Second))
+	}
+	return
+}
+
+type connRates struct {
+	lock  sync.Mutex
+	conns map[string]*connRate
+}
+
+func (r *connRates) Acquire(addr string) (rate *connRate) {
+	r.lock.Lock()
+	if r.conns == nil {
+		r.conns = map[string]*connRate{}
+	}
+	rate = r.conns[addr]
+	if rate == nil {
+		rate = &connRate{}
+		r.conns[addr] = rate
+	}
+	rate.refs += 1
+	r.lock.Unlock()
+	return
+}
+
+func (r *connRates) Release(addr string) {
+	r.lock.Lock()
+	rate := r.conns[addr]
+	if rate != nil {
+		rate.refs -= 1
+		if rate.refs <= 0 {
+			delete(r.conns, addr)
+		}
+	}
+	r.lock.Unlock()
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	rate   int
+	bucket *connRate
+}
+
+func (w *throttledWriter) Write(data []byte) (n int, err error) {
+	chunk := w.rate / 10
+	if chunk < 1 {
+		chunk = 1
+	} else if chunk > 32*1024 {
+		chunk = 32 * 1024
+	}
+
+	for len(data) > 0 {
+		size := len(data)
+		if size > chunk {
+			size = chunk
+		}
+
+		wait := w.bucket.Reserve(size, w.rate, chunk)
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-w.ctx.Done():
+				timer.Stop()
+				err = w.ctx.Err()
+				return
+			case <-timer.C:
+			}
+		}
+
+		written, e := w.ResponseWriter.Write(data[:size])
+		n += written
+		if e != nil {
+			err = e
+			return
+		}
+		data = data[size:]
+	}
+
+	return
+}
+
+type VirtualHosts struct {
+	Hosts  map[string]*StaticHandler
+	Strict bool
+}
+
+func (v *VirtualHosts) Handle(c *gin.Context) {
+	host := c.Request.Host
+	hostname, _, err := net.SplitHostPort(host)
+	if err == nil {
+		host = hostname
+	}
+
+	handler, ok := v.Hosts[strings.ToLower(host)]
+	if !ok {
+		if v.Strict {
+			c.AbortWithStatus(404)
+		}
+		return
+	}
+
+	if handler.MemFS && (c.Request.Method == "PUT" ||
+		c.Request.Method == "DELETE") {
+
+		handler.HandleMemWrite(c)
+		c.Abort()
+		return
+	}
+
+	if c.Request.Method == "POST" || c.Request.Method == "PUT" ||
+		c.Request.Method == "DELETE" {
+
+		handler.MethodNotAllowed(c)
+		c.Abort()
+		return
+	}
+
+	if c.Request.Method != "GET" && c.Request.Method != "HEAD" {
+		return
+	}
+
+	handler.Handle(c)
+	c.Abort()
+}
+
+type ListingData struct {
+	Title     string
+	Path      string
+	Items     []Item
+	Total     int
+	Truncated bool
+	Nonce     string
+}
+
+type StaticHandler struct {
+	Root              string
+	Cache             bool
+	ContentType       string
+	ListingPerms      bool
+	ListingFilter     bool
+	MaskForbidden     bool
+	OptInListing      bool
+	ListingMaxEntries int
+	HideFromListing   []string
+	Sitemap           bool
+	BaseURL           string
+	CacheRules        map[string]string
+	CSP               string
+	CSPNonce          bool
+	GzipListing       bool
+	CompressLevel     int
+	ListingTitle      string
+	ListingFooter     string
+	ListingFooterHtml string
+	XAccelRedirect    string
+	XSendfile         bool
+	Checksums         bool
+	GroupByType       bool
+	MarkdownIndex     []string
+	AllowForceListing bool
+	Thumbnails        bool
+	I18n              bool
+	Preload           []PreloadRule
+	RateLimitBytes    int
+	ListingTemplate   *template.Template
+	RedirectCode      int
+	Manifest          map[string][]byte
+	Overlays          []string
+	MaxSymlinkDepth   int
+	HideSizes         string
+	StrictSlash       bool
+	StrictSlash404    bool
+	LogFilePath       bool
+	EmptyDir          string
+	LaxPaths          bool
+	GitSafe           bool
+	FileLimit         *FileLimiter
+	Quota             *Quota
+	SingleFile        bool
+	FileMetaHeaders   bool
+	FileModeHeader    bool
+	LiveReload        bool
+	GzipListingCache  bool
+	Robots            string
+	PadTo             int
+	Digest            string
+	RelativeTime      bool
+	OwnerUid          int
+	Meta              bool
+	CaseFold          bool
+	EarlyHints        bool
+	NaturalSort       bool
+	MaxDepth          int
+	CAS               bool
+	CASPrefix         string
+	MemFS             bool
+	fileServer        http.Handler
+	routes            map[string]gin.HandlerFunc
+	sitemap           *sitemapCache
+	checksums         *checksumCache
+	cas               *casIndex
+	memFS             *memFS
+	thumbnails        *thumbCache
+	liveReload        *liveReload
+	gzipListings      *gzipCache
+	folds             *foldCache
+	connRates         *connRates
+	noncePlaceholder  string
+	gzipWriters       *sync.Pool
+}
+
+func (h *StaticHandler) Handle(c *gin.Context) {
+	if !h.LaxPaths && !safePath(c.Param("filepath")) {
+		c.AbortWithStatus(400)
+		return
+	}
+
+	if h.GitSafe && vcsPath(c.Param("filepath")) {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	if h.MaxDepth > 0 && pathDepth(c.Param("filepath")) > h.MaxDepth {
+		c.AbortWithStatus(404)
+		return
+	}
+
+	handler, ok := h.routes[c.Param("filepath")]
+	if ok {
+		handler(c)
+		return
+	}
+
+	if h.CAS && strings.HasPrefix(c.Param("filepath"), h.CASPrefix) {
+		h.HandleBlob(c)
+		return
+	}
+
+	path := h.resolvePath(c.Param("filepath"))
+	if h.CaseFold && !h.SingleFile {
+		exists, err := Exists(path)
+		if err == nil && !exists {
+			folded, found := h.foldPath(c.Param("filepath"))
+			if found {
+				for i := range c.Params {
+					if c.Params[i].Key == "filepath" {
+						c.Params[i].Value = folded
+					}
+				}
+				c.Request.URL.Path = folded
+				c.Request.URL.RawPath = ""
+				path = h.resolvePath(folded)
+			}
+		}
+	}
+	if h.LogFilePath {
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			realPath = path
+		}
+		c.Set("filepath", realPath)
+	}
+
+	cacheControl := h.cacheRule(path)
+	if cacheControl != "" {
+		c.Writer.Header().Set("Cache-Control", cacheControl)
+	} else if !h.Cache {
+		c.Writer.Header().Add("Cache-Control",
+			"no-cache, no-store, must-revalidate")
+		c.Writer.Header().Add("Pragma", "no-cache")
+		c.Writer.Header().Add("Expires", "0")
+	}
+
+	if h.memFS != nil && h.HandleMemFile(c) {
+		return
+	}
+
+	if h.SingleFile {
+		err := h.verifyFile(path)
+		if err != nil {
+			c.AbortWithError(500, err)
+			return
+		}
+		if h.ContentType != "" {
+			c.Writer.Header().Set("Content-Type", h.ContentType)
+		}
+
+		writer, release, allowed := h.fileWriter(c)
+		defer release()
+		if !allowed {
+			return
+		}
+		http.ServeFile(writer, c.Request, path)
+		return
+	}
+
+	if h.OwnerUid >= 0 {
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() && !h.ownedBy(info) {
+			c.AbortWithStatus(404)
+			return
+		}
+	}
+
+	if h.Checksums {
+		ok, err := h.HandleChecksum(path, c)
+		if err != nil {
+			if os.IsPermission(err) {
+				h.forbidden(c)
+				return
+			}
+			c.AbortWithError(500, err)
+			return
+		}
+		if ok {
+			return
+		}
+	}
+
+	if h.Thumbnails {
+		ok, err := h.HandleThumbnail(path, c)
+		if err != nil {
+			if os.IsPermission(err) {
+				h.forbidden(c)
+				return
+			}
+			c.AbortWithError(500, err)
+			return
+		}
+		if ok {
+			return
+		}
+	}
+
+	isDir, err := IsDirectory(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			h.forbidden(c)
+			return
+		}
+		c.AbortWithError(500, err)
+		return
+	}
+	if !isDir && h.memFS != nil {
+		isDir = h.memFS.IsDir(c.Param("filepath"))
+	}
+
+	if h.StrictSlash && !isDir && c.Request.URL.Path != "/" &&
+		strings.HasSuffix(c.Request.URL.Path, "/") {
+
+		exists, err := Exists(path)
+		if err != nil {
+			c.AbortWithError(500, err)
+			return
+		}
+
+		if exists {
+			if h.StrictSlash404 {
+				c.AbortWithStatus(404)
+				return
+			}
+
+			location := strings.TrimRight(c.Request.URL.Path, "/")
+			if c.Request.URL.RawQuery != "" {
+				location += "?" + c.Request.URL.RawQuery
+			}
+			c.Redirect(h.redirectCode(c), location)
+			return
+		}
+	}
+
+	ok = false
+	if isDir {
+		ok, err = h.HandleDirList(path, c)
+		if err != nil {
+			if os.IsPermission(err) {
+				h.forbidden(c)
+				return
+			}
+			c.AbortWithError(500, err)
+			return
+		}
+	}
+
+	if !ok && !isDir && (h.XAccelRedirect != "" || h.XSendfile) {
+		exists, err := Exists(path)
+		if err == nil {
+			err = h.verifyFile(path)
+		}
+		if err != nil {
+			c.AbortWithError(500, err)
+			return
+		}
+
+		if exists {
+			if h.XSendfile {
+				c.Writer.Header().Set("X-Sendfile", path)
+			} else {
+				internalUrl := &url.URL{
+					Path: strings.TrimSuffix(h.XAccelRedirect, "/") +
+						filepath.Clean("/"+c.Param("filepath")),
+				}
+				c.Writer.Header().Set("X-Accel-Redirect",
+					internalUrl.EscapedPath())
+			}
+			c.Status(200)
+			return
+		}
+	}
+
+	if !ok {
+		if isDir && h.Manifest != nil {
+			err = h.verifyFile(
+				h.resolvePath(c.Param("filepath") + "/index.html"))
+			if err != nil {
+				c.AbortWithError(500, err)
+				return
+			}
+		}
+
+		if h.ContentType != "" {
+			c.Writer.Header().Add("Content-Type", h.ContentType)
+		}
+
+		if h.CSP != "" && (isDir || h.isHTML(path)) {
+			c.Writer.Header().Set("Content-Security-Policy", h.CSP)
+		}
+
+		if len(h.Preload) > 0 && (isDir || h.isHTML(path)) {
+			h.preloadLinks(c)
+		}
+
+		if h.PadTo > 0 && !isDir {
+			info, err := os.Stat(path)
+			if err == nil && info.Mode().IsRegular() &&
+				info.Size()%int64(h.PadTo) != 0 {
+
+				padding, err := randPadding(
+					h.PadTo - int(info.Size()%int64(h.PadTo)))
+				if err != nil {
+					c.AbortWithError(500, err)
+					return
+				}
+				c.Writer.Header().Set("X-Padding", padding)
+			}
+		}
+
+		if h.Digest != "" && !isDir {
+			info, err := os.Stat(path)
+			if err == nil && info.Mode().IsRegular() {
+				err = h.setDigest(path, info, c)
+				if err != nil {
+					if os.IsPermission(err) {
+						h.forbidden(c)
+						return
+					}
+					c.AbortWithError(500, err)
+					return
+				}
+			}
+		}
+
+		if h.FileMetaHeaders && !isDir {
+			info, err := os.Stat(path)
+			if err == nil && info.Mode().IsRegular() {
+				header := c.Writer.Header()
+				header.Set("X-File-Size", strconv.FormatInt(info.Size(), 10))
+				header.Set("X-File-Modtime",
+					info.ModTime().UTC().Format(time.RFC3339))
+				if h.FileModeHeader {
+					header.Set("X-File-Mode",
+						fmt.Sprintf("%04o", info.Mode().Perm()))
+				}
+			}
+		}
+
+		if h.LiveReload && (isDir || h.isHTML(path)) {
+			htmlPath := path
+			if isDir {
+				htmlPath = h.resolvePath(c.Param("filepath") + "/index.html")
+			}
+
+			ok, err := h.serveLiveReloadHTML(htmlPath, c)
+			if err != nil {
+				if os.IsPermission(err) {
+					h.forbidden(c)
+					return
+				}
+				c.AbortWithError(500, err)
+				return
+			}
+			if ok {
+				return
+			}
+		}
+
+		writer, release, allowed := h.fileWriter(c)
+		defer release()
+		if !allowed {
+			return
+		}
+		h.fileServer.ServeHTTP(writer, c.Request)
+	}
+}
+
+func (h *StaticHandler) isHTML(path string) bool {
+	contentType := h.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	return strings.HasPrefix(contentType, "text/html")
+}
+
+func (h *StaticHandler) preloadLinks(c *gin.Context) {
+	reqPath := filepath.ToSlash(filepath.Clean("/" + c.Param("filepath")))
+	matched := false
+	for _, rule := range h.Preload {
+		match, _ := path.Match(rule.Pattern, reqPath)
+		if match {
+			c.Writer.Header().Add("Link", rule.Link)
+			matched = true
+		}
+	}
+
+	if matched && h.EarlyHints {
+		writeEarlyHints(c)
+	}
+}
+
+func writeEarlyHints(c *gin.Context) {
+	if !c.Request.ProtoAtLeast(1, 1) || c.Writer.Written() {
+		return
+	}
+
+	var writer http.ResponseWriter = c.Writer
+	for {
+		wrapped, ok := writer.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		writer = wrapped.Unwrap()
+	}
+	if _, ok := writer.(gin.ResponseWriter); ok {
+		return
+	}
+
+	writer.WriteHeader(103)
+}
+
+func (h *StaticHandler) cacheRule(path string) string {
+	control, ok := h.CacheRules[strings.ToLower(filepath.Ext(path))]
+	if ok {
+		return control
+	}
+	return h.CacheRules["*"]
+}
+
+func (h *StaticHandler) redirectCode(c *gin.Context) (code int) {
+	code = h.RedirectCode
+	if code == 0 {
+		code = 301
+	}
+	if c.Request.Method != "GET" && c.Request.Method != "HEAD" {
+		if code == 301 {
+			code = 308
+		} else if code == 302 {
+			code = 307
+		}
+	}
+	return
+}
+
+func (h *StaticHandler) forbidden(c *gin.Context) {
+	if h.MaskForbidden {
+		c.AbortWithStatus(404)
+	} else {
+		c.AbortWithStatus(403)
+	}
+}
+
+func (h *StaticHandler) fileWriter(c *gin.Context) (
+	writer http.ResponseWriter, release func(), ok bool) {
+
+	release = func() {}
+	if h.Quota != nil && !h.Quota.Allow(c) {
+		return
+	}
+	if h.FileLimit != nil {
+		if !h.FileLimit.Acquire(c) {
+			return
+		}
+		release = h.FileLimit.Release
+	}
+
+	writer = c.Writer
+	if h.Quota != nil {
+		c.Set("quotaCounted", true)
+		writer = &quotaWriter{
+			ResponseWriter: writer,
+			quota:          h.Quota,
+		}
+	}
+	if h.MaskForbidden {
+		writer = &maskForbiddenWriter{
+			ResponseWriter: writer,
+		}
+	}
+	if h.RateLimitBytes > 0 {
+		addr := c.Request.RemoteAddr
+		fileRelease := release
+		release = func() {
+			h.connRates.Release(addr)
+			fileRelease()
+		}
+
+		writer = &throttledWriter{
+			ResponseWriter: writer,
+			ctx:            c.Request.Context(),
+			rate:           h.RateLimitBytes,
+			bucket:         h.connRates.Acquire(addr),
+		}
+	}
+
+	ok = true
+	return
+}
+
+func (h *StaticHandler) HandleDirList(path string, c *gin.Context) (
+	ok bool, err error) {
+
+	pathFrm := filepath.Clean("/" + c.Param("filepath"))
+	if !strings.HasSuffix(pathFrm, "/") {
+		pathFrm += "/"
+	}
+
+	if !strings.HasSuffix(c.Request.URL.Path, "/") {
+		if h.StrictSlash && h.StrictSlash404 {
+			ok = true
+			c.AbortWithStatus(404)
+			return
+		}
+
+		location := c.Request.URL.Path + "/"
+		if c.Request.URL.RawQuery != "" {
+			location += "?" + c.Request.URL.RawQuery
+		}
+		ok = true
+		c.Redirect(h.redirectCode(c), location)
+		return
+	}
+
+	forceListing := h.AllowForceListing && c.Query("listing") == "1"
+
+	if h.I18n && !forceListing {
+		ok, err = h.HandleLocalizedIndex(path, c)
+		if err != nil || ok {
+			return
+		}
+	}
+
+	if len(h.MarkdownIndex) > 0 && !forceListing {
+		exists, e := h.ownedExists(filepath.Join(path, "index.html"))
+		if e != nil {
+			err = e
+			return
+		}
+
+		if !exists {
+			ok, err = h.HandleMarkdownIndex(path, pathFrm, c)
+			if err != nil || ok {
+				return
+			}
+		}
+	}
+
+	if h.OptInListing {
+		exists, e := Exists(filepath.Join(path, ".listing"))
+		if e != nil {
+			err = e
+			return
+		}
+
+		if !exists {
+			exists, err = h.ownedExists(
+				filepath.Join(path, "index.html"))
+			if err != nil || exists {
+				return
+			}
+
+			ok = true
+			h.forbidden(c)
+			return
+		}
+	}
+
+	stamp := ""
+	if h.GzipListingCache && !h.RelativeTime &&
+		c.Query("format") != "rss" && !c.Request.URL.Query().Has("json") {
+
+		stamp, err = h.listingStamp(c, forceListing)
+		if err != nil {
+			return
+		}
+
+		entry, found := h.gzipListings.Get(path, stamp)
+		if found {
+			ok = true
+			err = h.writeDirListing(c, entry)
+			return
+		}
+	}
+
+	items := &Items{
+		Natural: h.NaturalSort,
+	}
+	thumbs := []string{}
+	now := time.Now()
+
+	itemsAll, itemDirs, err := h.readDirLayers(path, c)
+	if err != nil {
+		return
+	}
+	if h.MaxDepth > 0 && pathDepth(c.Param("filepath")) >= h.MaxDepth {
+		itemsAll = nil
+	}
+
+	for _, item := range itemsAll {
+		name := item.Name()
+		if name == "index.html" && !forceListing {
+			owned := h.ownedBy(item)
+			if item.Mode()&os.ModeSymlink != 0 {
+				owned, err = h.ownedExists(
+					filepath.Join(itemDirs[name], name))
+				if err != nil {
+					return
+				}
+			}
+			if owned {
+				return
+			}
+		}
+		if h.OptInListing && name == ".listing" {
+			continue
+		}
+		if h.hiddenFromListing(name) {
+			continue
+		}
+
+		modTime := item.ModTime().Format("02-Jan-2006 15:04")
+		if h.RelativeTime {
+			ago := timeAgo(item.ModTime(), now)
+			modTime = fmt.Sprintf(`<span title="%s">%s</span>%s`, modTime,
+				ago, strings.Repeat(" ", 17-len(ago)))
+		}
+
+		if item.Mode()&os.ModeSymlink != 0 {
+			itm, e := resolveSymlink(
+				filepath.Join(itemDirs[item.Name()], item.Name()),
+				h.MaxSymlinkDepth)
+			if e != nil {
+				if os.IsNotExist(e) || e == errSymlinkDepth {
+					continue
+				}
+				err = e
+				return
+			}
+			item = itm
+		}
+
+		if !item.IsDir() && !h.ownedBy(item) {
+			continue
+		}
+
+		perms := ""
+		if h.ListingPerms {
+			owner, group, ok := fileOwner(item)
+			if ok {
+				perms = fmt.Sprintf(" %-10s %-8s %-8s",
+					item.Mode().String(), owner, group)
+			}
+		}
+
+		size := ""
+		itemSize := item.Size()
+		if item.IsDir() {
+			name += "/"
+			size = "-"
+		} else if h.HideSizes == "category" {
+			size = sizeCategory(itemSize)
+			itemSize = 0
+		} else if h.HideSizes == "hidden" {
+			size = "-"
+			itemSize = 0
+		} else {
+			size = fmt.Sprintf("%d", itemSize)
+		}
+
+		formattedName := []rune(name)
+		if len(formattedName) > 50 {
+			formattedName = append(formattedName[:47], []rune("..>")...)
+		}
+		padding := strings.Repeat(" ", 50-len(formattedName))
+
+		formatted := fmt.Sprintf(`<a href="%s">%s</a>%s%s %s %19s`,
+			listingHref(name), html.EscapeString(string(formattedName)),
+			padding, perms, modTime, size)
+		if h.ListingFilter {
+			formatted = fmt.Sprintf(`<span data-name="%s">%s`+"\n</span>",
+				html.EscapeString(name), formatted)
+		}
+
+		if h.Thumbnails && !item.IsDir() && isThumbImage(name) {
+			href := listingHref(name)
+			thumbs = append(thumbs, fmt.Sprintf(
+				`<a href="%s"><img src="%s?thumb=1&amp;w=%d" alt="%s" `+
+					`loading="lazy"></a>`, href, href, thumbWidth,
+				html.EscapeString(name)))
+		}
+
+		items.Add(Item{
+			Name:      name,
+			IsDir:     item.IsDir(),
+			ModTime:   item.ModTime(),
+			Size:      itemSize,
+			Category:  category(name, item.IsDir()),
+			Formatted: formatted,
+		})
+	}
+
+	if items.Len() == 0 && h.EmptyDir == "404" {
+		ok = true
+		c.AbortWithStatus(404)
+		return
+	}
+
+	items.Sort()
+	collisions := caseCollisions(items.items)
+
+	if c.Query("format") == "rss" {
+		ok = true
+		err = h.HandleDirFeed(pathFrm, items, c)
+		return
+	}
+
+	notice := ""
+	total := items.Len()
+	if h.ListingMaxEntries > 0 && total > h.ListingMaxEntries {
+		items.Truncate(h.ListingMaxEntries)
+		notice = fmt.Sprintf("\n\nShowing first %d of %d entries",
+			items.Len(), total)
+	} else if total == 0 && h.EmptyDir == "message" {
+		notice = "\nThis folder is empty"
+	}
+	if len(collisions) > 0 {
+		notice += fmt.Sprintf("\n\nWarning: names differ only by case: %s",
+			html.EscapeString(strings.Join(collisions, ", ")))
+	}
+
+	if c.Request.URL.Query().Has("json") {
+		ok = true
+		err = h.HandleDirJSON(pathFrm, items, total, c)
+		return
+	}
+
+	nonce := ""
+	nonceAttr := ""
+	if h.CSP != "" && h.CSPNonce {
+		nonce = h.noncePlaceholder
+		nonceAttr = fmt.Sprintf(` nonce="%s"`, nonce)
+	}
+
+	if h.ListingTemplate != nil {
+		buf := &bytes.Buffer{}
+		err = h.ListingTemplate.Execute(buf, &ListingData{
+			Title:     strings.TrimSpace(h.ListingTitle + " " + pathFrm),
+			Path:      pathFrm,
+			Items:     items.items,
+			Total:     total,
+			Truncated: total > items.Len(),
+			Nonce:     nonce,
+		})
+		if err != nil {
+			return
+		}
+
+		ok = true
+		err = h.writeDirListing(c, h.cacheListing(path, stamp, buf.Bytes()))
+		return
+	}
+
+	sep := "\n"
+	script := ""
+	if h.ListingFilter {
+		sep = ""
+		script = fmt.Sprintf(filterScript, nonceAttr)
+	}
+	if h.LiveReload {
+		script += fmt.Sprintf(liveReloadScript, nonceAttr, liveReloadPath)
+	}
+
+	listing := ""
+	if h.GroupByType {
+		sections := []string{}
+		for _, category := range categories {
+			group := &Items{}
+			for _, item := range items.items {
+				if item.Category == category {
+					group.Add(item)
+				}
+			}
+
+			if group.Len() > 0 {
+				sections = append(sections,
+					"<b>"+category+"</b>\n"+group.Join(sep))
+			}
+		}
+		listing = "\n" + strings.Join(sections, sep+"\n")
+	} else {
+		listing = items.Join(sep)
+	}
+
+	title := html.EscapeString(h.ListingTitle + " " + pathFrm)
+
+	footer := ""
+	if h.ListingFooter != "" || h.ListingFooterHtml != "" {
+		footer = fmt.Sprintf("<address>%s%s</address>\n",
+			html.EscapeString(h.ListingFooter), h.ListingFooterHtml)
+	}
+
+	grid := ""
+	if len(thumbs) > 0 {
+		grid = "<p>\n" + strings.Join(thumbs, "\n") + "\n</p><hr>"
+	}
+
+	ok = true
+	data := []byte(fmt.Sprintf(body, title, title, grid,
+		listing+notice, footer, script))
+	err = h.writeDirListing(c, h.cacheListing(path, stamp, data))
+
+	return
+}
+
+func (h *StaticHandler) listingStamp(c *gin.Context, forceListing bool) (
+	stamp string, err error) {
+
+	relPath := filepath.FromSlash(filepath.Clean("/" + c.Param("filepath")))
+	stamp = strconv.FormatBool(forceListing)
+	for _, root := range h.roots() {
+		info, e := os.Stat(filepath.Join(root, relPath))
+		if e != nil {
+			if !os.IsNotExist(e) {
+				err = e
+				return
+			}
+			stamp += " -"
+			continue
+		}
+		stamp += " " + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+	}
+	if h.memFS != nil {
+		stamp += " " + strconv.FormatUint(h.memFS.Version(), 10)
+	}
+
+	return
+}
+
+func (h *StaticHandler) cacheListing(path string, stamp string,
+	data []byte) (entry gzipEntry) {
+
+	entry = gzipEntry{
+		stamp: stamp,
+		data:  data,
+	}
+	if stamp == "" {
+		return
+	}
+
+	if h.CSP == "" || !h.CSPNonce {
+		compressed, err := h.compressListing(data)
+		if err != nil {
+			return
+		}
+		entry.gzip = compressed
+	}
+	h.gzipListings.Put(path, entry)
+
+	return
+}
+
+func (h *StaticHandler) writeDirListing(c *gin.Context,
+	entry gzipEntry) (err error) {
+
+	data := entry.data
+	compressed := entry.gzip
+	if h.CSP != "" {
+		policy := h.CSP
+		if h.CSPNonce {
+			nonce, e := randNonce()
+			if e != nil {
+				err = e
+				return
+			}
+			policy = cspWithNonce(policy, nonce)
+			data = bytes.ReplaceAll(data, []byte(h.noncePlaceholder),
+				[]byte(nonce))
+			compressed = nil
+		}
+		c.Writer.Header().Set("Content-Security-Policy", policy)
+	}
+
+	if h.ListingTemplate == nil && len(h.Preload) > 0 {
+		h.preloadLinks(c)
+	}
+
+	err = h.writeListing(c, data, compressed)
+	return
+}
+
+func (h *StaticHandler) compressListing(data []byte) (
+	compressed []byte, err error) {
+
+	buf := &bytes.Buffer{}
+	writer := h.gzipWriters.Get().(*gzip.Writer)
+	defer h.gzipWriters.Put(writer)
+	writer.Reset(buf)
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return
+	}
+
+	compressed = buf.Bytes()
+	return
+}
+
+func (h *StaticHandler) writeListing(c *gin.Context, data []byte,
+	compressed []byte) (err error) {
+
+	if h.GzipListing {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		if acceptsGzip(c.Request) {
+			if compressed == nil {
+				compressed, err = h.compressListing(data)
+				if err != nil {
+					return
+				}
+			}
+
+			c.Writer.Header().Set("Content-Encoding", "gzip")
+			data = compressed
+		}
+	}
+
+	writeHTML(c, data)
+
+	return
+}
+
+func writeHTML(c *gin.Context, data []byte) {
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	c.Writer.WriteHeader(200)
+	_, _ = c.Writer.Write(data)
+}
+
+func listingHref(name string) string {
+	return html.EscapeString((&url.URL{Path: name}).String())
+}
+
+func pathDepth(pth string) (depth int) {
+	for _, part := range strings.Split(filepath.ToSlash(pth), "/") {
+		if part != "" && part != "." {
+			depth += 1
+		}
+	}
+	return
+}
+
+func vcsPath(pth string) bool {
+	for _, name := range strings.Split(pth, "/") {
+		if vcsDirs[strings.ToLower(name)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *StaticHandler) ownedBy(info os.FileInfo) bool {
+	if h.OwnerUid < 0 {
+		return true
+	}
+
+	uid, ok := fileUid(info)
+	return !ok || uid == h.OwnerUid
+}
+
+func (h *StaticHandler) ownedExists(path string) (exists bool, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if notExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	exists = info.IsDir() || h.ownedBy(info)
+	return
+}
+
+func (h *StaticHandler) hiddenFromListing(name string) bool {
+	if h.GitSafe && vcsDirs[strings.ToLower(name)] {
+		return true
+	}
+
+	for _, pattern := range h.HideFromListing {
+		match, _ := filepath.Match(pattern, name)
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *StaticHandler) MethodNotAllowed(c *gin.Context) {
+	allow := "GET, HEAD"
+	if h.MemFS {
+		allow += ", PUT, DELETE"
+	}
+	if h.Meta && c.Request.URL.Path == metaPath {
+		allow += ", POST"
+	}
+
+	c.Writer.Header().Set("Allow", allow)
+	c.AbortWithStatus(405)
+}
+
+func (h *StaticHandler) Init() {
+	layers := overlayFS{}
+	for _, root := range h.roots() {
+		var layer http.FileSystem = gin.Dir(root, false)
+		if h.Manifest != nil {
+			layer = manifestFS{
+				FileSystem: layer,
+				root:       root,
+				handler:    h,
+			}
+		}
+		layers = append(layers, layer)
+	}
+	var files http.FileSystem = layers
+	if h.MemFS {
+		h.memFS = &memFS{
+			base: layers,
+		}
+		files = h.memFS
+	}
+	if h.OwnerUid >= 0 {
+		files = ownerFS{
+			FileSystem: files,
+			uid:        h.OwnerUid,
+		}
+	}
+	h.fileServer = http.StripPrefix("/", http.FileServer(files))
+
+	h.checksums = &checksumCache{}
+	h.thumbnails = &thumbCache{}
+	h.gzipListings = &gzipCache{}
+	h.folds = &foldCache{}
+	h.connRates = &connRates{}
+	if h.CSPNonce {
+		placeholder, err := randNonce()
+		if err != nil {
+			panic(err)
+		}
+		h.noncePlaceholder = placeholder
+	}
+	h.cas = &casIndex{}
+	if h.CASPrefix == "" {
+		h.CASPrefix = casPrefix
+	}
+
+	compressLevel := h.CompressLevel
+	h.gzipWriters = &sync.Pool{
+		New: func() interface{} {
+			writer, _ := gzip.NewWriterLevel(nil, compressLevel)
+			return writer
+		},
+	}
+
+	h.routes = map[string]gin.HandlerFunc{}
+	if h.Sitemap {
+		h.sitemap = &sitemapCache{}
+		h.routes["/sitemap.xml"] = h.HandleSitemap
+	}
+	if h.Robots != "" {
+		h.routes["/robots.txt"] = h.HandleRobots
+	}
+	if h.LiveReload {
+		h.liveReload = &liveReload{
+			maxDepth: h.MaxDepth,
+		}
+		err := h.liveReload.Watch(h.roots())
+		if err != nil {
+			panic(err)
+		}
+		h.routes[liveReloadPath] = h.liveReload.Handle
+	}
+}
+
+func (h *StaticHandler) VirtualHost(root string) *StaticHandler {
+	vhost := *h
+	vhost.Root = root
+	vhost.Overlays = nil
+	vhost.Init()
+
+	return &vhost
+}
+
+func (h *StaticHandler) Setup(engine *gin.Engine) {
+	h.Init()
+
+	engine.GET("/*filepath", h.Handle)
+	engine.HEAD("/*filepath", h.Handle)
+	if h.Meta {
+		engine.POST(metaPath, h.HandleMeta)
+	}
+	if h.MemFS {
+		engine.PUT("/*filepath", h.HandleMemWrite)
+		engine.DELETE("/*filepath", h.HandleMemWrite)
+	}
+
+	engine.HandleMethodNotAllowed = true
+	engine.NoMethod(h.MethodNotAllowed)
+
+	return
+}
+
+var selfCertSigAlgos = map[string]x509.SignatureAlgorithm{
+	"p256":    x509.ECDSAWithSHA256,
+	"p384":    x509.ECDSAWithSHA384,
+	"ed25519": x509.PureEd25519,
+	"rsa2048": x509.SHA256WithRSA,
+}
+
+func selfCertKey(keyType string) (key crypto.Signer, err error) {
+	switch keyType {
+	case "p256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "p384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa2048":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		err = fmt.Errorf("unknown key type %s", keyType)
+	}
+	return
+}
+
+func selfCert(parent *x509.Certificate, parentKey crypto.Signer,
+	keyType string, validity time.Duration) (cert *x509.Certificate,
+	certByt []byte, certKey crypto.Signer, err error) {
+
+	certKey, err = selfCertKey(keyType)
+	if err != nil {
+		return
+	}
+
+	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return
+	}
+
+	certTempl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Pacur HTTP Server"},
+		},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		SignatureAlgorithm:    selfCertSigAlgos[keyType],
+	}
+
+	if _, ok := certKey.(*rsa.PrivateKey); ok {
+		certTempl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	if parent == nil {
+		certTempl.Subject.CommonName = "Pacur HTTP Server CA"
+		certTempl.IsCA = true
+		certTempl.KeyUsage |= x509.KeyUsageCertSign
+		parent = certTempl
+		parentKey = certKey
+	} else {
+		certTempl.DNSNames = []string{"localhost"}
+		certTempl.IPAddresses = []net.IP{
+			net.IPv4(127, 0, 0, 1),
+			net.IPv6loopback,
+		}
+	}
+
+	certByt, err = x509.CreateCertificate(rand.Reader, certTempl, parent,
+		certKey.Public(), parentKey)
+	if err != nil {
+		return
+	}
+
+	cert, err = x509.ParseCertificate(certByt)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func parseCipherSuites(names string) (ids []uint16, err error) {
+	suites := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		for _, version := range suite.SupportedVersions {
+			if version == tls.VersionTLS12 {
+				suites[suite.Name] = suite.ID
+				break
+			}
+		}
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		id, ok := suites[name]
+		if !ok {
+			err = fmt.Errorf("unknown or insecure TLS 1.2 cipher suite %s",
+				name)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	return
+}
+
+func loadSessionTicketKeys(path string) (keys [][32]byte, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyByt, e := hex.DecodeString(line)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if len(keyByt) != 32 {
+			err = fmt.Errorf("session ticket key in %s is not 32 bytes",
+				path)
+			return
+		}
+
+		key := [32]byte{}
+		copy(key[:], keyByt)
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		err = fmt.Errorf("no session ticket keys in %s", path)
+		return
+	}
+
+	return
+}
+
+func interfaceAddrs(name string, port int) (addrs []string, err error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return
+	}
+
+	ifaceAddrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+
+	for _, ifaceAddr := range ifaceAddrs {
+		ipNet, ok := ifaceAddr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		host := ipNet.IP.String()
+		if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+			host += "%" + iface.Name
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+
+	if len(addrs) == 0 {
+		err = fmt.Errorf("interface %s has no usable address", name)
+		return
+	}
+
+	return
+}
+
+func envPem(name string) (data []byte, err error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		err = fmt.Errorf("environment variable %s is not set", name)
+		return
+	}
+
+	if strings.HasPrefix(value, "-----BEGIN") {
+		data = []byte(value)
+		return
+	}
+
+	data, err = base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		err = fmt.Errorf("environment variable %s is not PEM or "+
+			"base64 encoded PEM", name)
+		return
+	}
+
+	return
+}
+
+func envKeyPair(certName string, keyName string) (
+	keypair tls.Certificate, err error) {
+
+	certPem, err := envPem(certName)
+	if err != nil {
+		return
+	}
+
+	keyPem, err := envPem(keyName)
+	if err != nil {
+		return
+	}
+
+	keypair, err = tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		err = fmt.Errorf("invalid certificate or key in %s and %s: %w",
+			certName, keyName, err)
+		return
+	}
+
+	return
+}
+
+func selfKeyPair(keyType string, validity time.Duration) (
+	keypair tls.Certificate, caPem []byte, err error) {
+
+	caCert, caByt, caKey, err := selfCert(nil, nil, keyType, validity)
+	if err != nil {
+		return
+	}
+
+	_, certByt, certKey, err := selfCert(caCert, caKey, keyType, validity)
+	if err != nil {
+		return
+	}
+
+	certKeyByte, err := x509.MarshalPKCS8PrivateKey(certKey)
+	if err != nil {
+		return
+	}
+
+	certKeyBlock := &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: certKeyByte,
+	}
+	keyPem := pem.EncodeToMemory(certKeyBlock)
+
+	certBlock := &pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certByt,
+	}
+	certPem := pem.EncodeToMemory(certBlock)
+
+	keypair, err = tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return
+	}
+
+	caPem = pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: caByt,
+	})
+
+	return
+}
+
+func main() {
+	err := initMime()
+	if err != nil {
+		panic(err)
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+
+	pathPtr := flag.String("path", path, "Path to serve")
+	hostPtr := flag.String("host", "[::]", "Server host")
+	interfacePtr := flag.String("interface", "",
+		"Bind to all addresses of network interface (overrides -host)")
+	portPtr := flag.Int("port", 8000, "Server port number")
+	cachePtr := flag.Bool("cache", false, "Enable cache")
+	tlsServerPtr := flag.Bool("tls", false, "Enable TLS server")
+	contentTypePtr := flag.String("type", "", "Force content type")
+	noKeepAlivePtr := flag.Bool("no-keepalive", false,
+		"Disable HTTP keep-alives")
+	tcpKeepAlivePtr := flag.Duration("tcp-keepalive", 0,
+		"TCP keep-alive period (0 for default, negative to disable)")
+	noDelayPtr := flag.Bool("nodelay", true,
+		"Set TCP_NODELAY on connections, Go enables it by default")
+	reusePortPtr := flag.Bool("reuseport", false,
+		"Set SO_REUSEPORT to allow multiple instances on one port")
+	listingPermsPtr := flag.Bool("listing-perms", false,
+		"Show file mode, owner and group in directory listing")
+	retryAfterPtr := flag.Int("retry-after", 120,
+		"Retry-After seconds sent with unavailable responses")
+	certPtr := flag.String("cert", "", "TLS certificate file (requires -tls)")
+	keyPtr := flag.String("key", "", "TLS private key file (requires -tls)")
+	certEnvPtr := flag.String("cert-env", "",
+		"Environment variable with PEM or base64 PEM TLS certificate")
+	keyEnvPtr := flag.String("key-env", "",
+		"Environment variable with PEM or base64 PEM TLS private key")
+	ocspStaplePtr := flag.String("ocsp-staple", "",
+		"DER encoded OCSP response file to staple (requires -cert)")
+	ciphersPtr := flag.String("ciphers", "",
+		"Comma separated list of TLS 1.2 cipher suites")
+	listingFilterPtr := flag.Bool("listing-filter", false,
+		"Add a filter box to directory listings")
+	maskForbiddenPtr := flag.Bool("mask-forbidden", false,
+		"Respond with 404 instead of 403 for denied paths")
+	optInListingPtr := flag.Bool("opt-in-listing", false,
+		"Only list directories containing a .listing file")
+	slowThresholdPtr := flag.Duration("slow-threshold", 0,
+		"Log a warning for requests slower than this duration")
+	listingMaxEntriesPtr := flag.Int("listing-max-entries", 0,
+		"Maximum number of entries shown in a directory listing, "+
+			"after sorting and filtering")
+	noSessionTicketsPtr := flag.Bool("no-session-tickets", false,
+		"Disable TLS session tickets")
+	sessionTicketKeysPtr := flag.String("session-ticket-keys", "",
+		"File of hex encoded 32 byte TLS session ticket keys, one per line")
+	hideFromListing := stringsFlag{}
+	flag.Var(&hideFromListing, "hide-from-listing",
+		"Glob of names to hide from directory listing (repeatable)")
+	sitemapPtr := flag.Bool("sitemap", false,
+		"Serve a generated /sitemap.xml of HTML files (requires -base-url)")
+	baseURLPtr := flag.String("base-url", "",
+		"External base URL used for generated sitemap and feed links")
+	cacheRules := stringsFlag{}
+	flag.Var(&cacheRules, "cache-rule",
+		"Cache-Control max-age by extension such as "+
+			"'.js=31536000,immutable', '*' sets the default (repeatable)")
+	cspPtr := flag.String("csp", "",
+		"Content-Security-Policy header for HTML responses")
+	cspNoncePtr := flag.Bool("csp-nonce", false,
+		"Add a per response script nonce to the listing and -csp policy")
+	vhosts := stringsFlag{}
+	flag.Var(&vhosts, "vhost",
+		"Serve path for requests to host such as "+
+			"'a.example.com=/srv/a' (repeatable)")
+	vhostStrictPtr := flag.Bool("vhost-strict", false,
+		"Respond 404 to hosts not matching a -vhost")
+	safeRecoveryPtr := flag.Bool("safe-recovery", false,
+		"Log panics without stack traces unless -debug is set")
+	debugPtr := flag.Bool("debug", false, "Enable debug logging")
+	gzipListingPtr := flag.Bool("gzip-listing", false,
+		"Gzip compress directory listings when accepted by the client")
+	maxPathLenPtr := flag.Int("max-path-len", 4096,
+		"Maximum request path length (0 for unlimited)")
+	listingTitlePtr := flag.String("listing-title", "Index of",
+		"Directory listing title, followed by the path")
+	listingFooterPtr := flag.String("listing-footer", "",
+		"Text shown at the bottom of directory listings")
+	listingFooterHtmlPtr := flag.String("listing-footer-html", "",
+		"Trusted HTML shown at the bottom of directory listings")
+	logSamplePtr := flag.Uint64("log-sample", 1,
+		"Log only 1 in N successful requests, errors are always logged")
+	xAccelPtr := flag.String("x-accel", "",
+		"Delegate file transfers to nginx with X-Accel-Redirect "+
+			"to this internal location")
+	xSendfilePtr := flag.Bool("x-sendfile", false,
+		"Delegate file transfers to the proxy with X-Sendfile")
+	checksumsPtr := flag.Bool("checksums", false,
+		"Serve file checksums with ?checksum=sha256 or a .sha256 suffix")
+	groupByTypePtr := flag.Bool("group-by-type", false,
+		"Group directory listing into sections by file type")
+	warmupPtr := flag.Duration("warmup", 0,
+		"Respond 503 for this duration after startup")
+	compressLevelPtr := flag.String("compress-level", "default",
+		"Compression level 1-9, best-speed or best-compression")
+	markdownIndexPtr := flag.String("markdown-index", "",
+		"Comma separated Markdown files rendered as the directory index "+
+			"when index.html is missing such as 'index.md,README.md'")
+	snapshotPtr := flag.Bool("snapshot", false,
+		"Resolve symlinks in the served paths once at startup")
+	allowForceListingPtr := flag.Bool("allow-force-listing", false,
+		"Allow ?listing=1 to list directories containing an index")
+	canonicalHostPtr := flag.String("canonical-host", "",
+		"Redirect requests for other hosts to this host")
+	thumbnailsPtr := flag.Bool("thumbnails", false,
+		"Show thumbnails for images in directory listings")
+	i18nPtr := flag.Bool("i18n", false,
+		"Serve index.LANG.html based on Accept-Language")
+	preloads := stringsFlag{}
+	flag.Var(&preloads, "preload",
+		"Link header for HTML matching a request path pattern such as "+
+			"'/docs/*=</app.css>; rel=preload; as=style' (repeatable)")
+	rateLimitBytesPtr := flag.Int("rate-limit-bytes", 0,
+		"Limit file download speed in bytes per second per "+
+			"connection (0 to disable)")
+	listingTemplatePtr := flag.String("listing-template", "",
+		"Path to html/template file used to render directory listings")
+	redirectCodePtr := flag.Int("redirect-code", 301,
+		"Status code for directory trailing slash redirects "+
+			"(301, 302, 307 or 308)")
+	manifestPtr := flag.String("manifest", "",
+		"Verify served files against a file of 'sha256  path' lines, "+
+			"with paths relative to -path")
+	logVhostPtr := flag.Bool("log-vhost", false,
+		"Prefix access log lines with the request Host header")
+	overlays := stringsFlag{}
+	flag.Var(&overlays, "overlay",
+		"Directory checked before -path but not before -vhost paths, "+
+			"earlier overlays take precedence (repeatable)")
+	debugConfigPtr := flag.String("debug-config", "",
+		"Address of a separate listener serving the effective "+
+			"configuration as JSON at /config such as 127.0.0.1:8001")
+	maxSymlinkDepthPtr := flag.Int("max-symlink-depth", 8,
+		"Maximum symlinks followed when resolving a listing entry")
+	hideSizesPtr := flag.String("hide-sizes", "",
+		"Replace listing file sizes with 'category' (small, medium, "+
+			"large) or 'hidden'")
+	errorFormatPtr := flag.String("error-format", "text",
+		"Format of error response bodies, 'text' or 'json'")
+	strictSlashPtr := flag.Bool("strict-slash", false,
+		"Redirect files requested with a trailing slash to the path "+
+			"without it")
+	strictSlash404Ptr := flag.Bool("strict-slash-404", false,
+		"With -strict-slash respond 404 instead of redirecting "+
+			"non-canonical paths")
+	logFilePathPtr := flag.Bool("log-filepath", false,
+		"Include the resolved filesystem path in access log lines")
+	emptyDirPtr := flag.String("empty-dir", "listing",
+		"Response for empty directories, 'listing', '404' or 'message'")
+	noDefaultMiddlewarePtr := flag.Bool("no-default-middleware", false,
+		"Disable the access logger and panic recovery middleware")
+	laxPathsPtr := flag.Bool("lax-paths", false,
+		"Allow request paths with control characters and on Windows "+
+			"backslashes, colons and device names")
+	gitSafePtr := flag.Bool("git-safe", false,
+		"Hide and respond 404 for .git, .svn, .hg and .bzr")
+	maxOpenFilesPtr := flag.Int("max-open-files", 0,
+		"Maximum files served concurrently, additional requests wait "+
+			"(0 to disable)")
+	maxOpenFilesRejectPtr := flag.Bool("max-open-files-reject", false,
+		"Respond 503 instead of waiting when -max-open-files is reached")
+	singleFilePtr := flag.Bool("single-file", false,
+		"Serve the file at -path for every request when it is not "+
+			"a directory")
+	fileMetaHeadersPtr := flag.Bool("file-meta-headers", false,
+		"Send X-File-Size and X-File-Modtime headers with files")
+	fileModeHeaderPtr := flag.Bool("file-mode-header", false,
+		"Also send the X-File-Mode permission bits header "+
+			"(requires -file-meta-headers)")
+	liveReloadPtr := flag.Bool("live-reload", false,
+		"Development only, reload browsers when files change")
+	corpPtr := flag.String("corp", "",
+		"Cross-Origin-Resource-Policy header such as 'same-origin'")
+	coopPtr := flag.String("coop", "",
+		"Cross-Origin-Opener-Policy header such as 'same-origin'")
+	coepPtr := flag.String("coep", "",
+		"Cross-Origin-Embedder-Policy header such as 'require-corp'")
+	gzipListingCachePtr := flag.Bool("gzip-listing-cache", false,
+		"Cache compressed listings until the directory changes "+
+			"(requires -gzip-listing)")
+	robotsPtr := flag.String("robots", "",
+		"Serve /robots.txt when the root has none, 'allow', 'deny' "+
+			"or path to a robots.txt file")
+	padToPtr := flag.Int("pad-to", 0,
+		"Pad file responses to a multiple of this many bytes with an "+
+			"X-Padding header, the body is not padded "+
+			"(0 to disable, max 16384)")
+	digestPtr := flag.String("digest", "",
+		"Send a Digest header with files using md5, sha, sha-256 or "+
+			"sha-512 unless Want-Digest prefers another")
+	logTLSPtr := flag.Bool("log-tls", false,
+		"Include TLS version, cipher suite, SNI and ALPN in access log "+
+			"lines (requires -tls)")
+	createRootPtr := flag.Bool("create-root", false,
+		"Create the -path directory if it does not exist")
+	relativeTimePtr := flag.Bool("relative-time", false,
+		"Show listing modification times relative to now")
+	ownerUidPtr := flag.Int("owner-uid", -1,
+		"Only serve and list files owned by this user id "+
+			"(no effect on Windows)")
+	metaPtr := flag.Bool("meta", false,
+		"Serve POST /__meta returning metadata for a JSON array of paths")
+	maxConnsPerIpPtr := flag.Int("max-conns-per-ip", 0,
+		"Maximum concurrent requests from a single client IP, "+
+			"extra requests return 503 (0 for unlimited)")
+	bandwidthQuotaPtr := flag.Uint64("bandwidth-quota", 0,
+		"Maximum total bytes served per quota period, "+
+			"file requests return 503 once exceeded (0 to disable)")
+	quotaResetPtr := flag.Duration("quota-reset", 24*time.Hour,
+		"Interval at which the -bandwidth-quota counter is reset "+
+			"(0 to never reset)")
+	caseFoldPtr := flag.Bool("case-fold", false,
+		"Serve a case-insensitive match when the exact path does not "+
+			"exist, preferring the first name alphabetically")
+	earlyHintsPtr := flag.Bool("early-hints", false,
+		"Send the -preload links in a 103 Early Hints response before "+
+			"HTML pages and listings")
+	naturalSortPtr := flag.Bool("natural-sort", false,
+		"Sort listing names with numbers compared by value so file2 "+
+			"comes before file10")
+	maxDepthPtr := flag.Int("max-depth", 0,
+		"Maximum number of path segments below the root that can be "+
+			"served, listed or walked (0 for unlimited)")
+	selfCertKeyTypePtr := flag.String("selfcert-key-type", "p384",
+		"Key type for the generated self-signed certificate, 'p256', "+
+			"'p384', 'ed25519' or 'rsa2048'")
+	selfCertValidityPtr := flag.Duration("selfcert-validity",
+		26280*time.Hour, "Validity of the generated self-signed "+
+			"certificate from startup")
+	exportCaPtr := flag.String("export-ca", "",
+		"Write the generated self-signed CA certificate in PEM format "+
+			"to this path (requires -tls)")
+	backlogPtr := flag.Int("backlog", 0,
+		"Listen backlog for pending connections, capped by the "+
+			"system maximum (0 for the system default)")
+	casPtr := flag.Bool("cas", false,
+		"Serve files by the sha256 of their content at /blob/<sha256>")
+	casPrefixPtr := flag.String("cas-prefix", casPrefix,
+		"Path prefix for -cas, it hides a directory served at the "+
+			"same path")
+	noColorPtr := flag.Bool("no-color", os.Getenv("NO_COLOR") != "",
+		"Disable colors in console logs, the default when NO_COLOR is "+
+			"set (colors are already off when output is not a terminal)")
+	rewrites := stringsFlag{}
+	flag.Var(&rewrites, "rewrite",
+		"Rewrite request paths matching a regular expression such as "+
+			"'^/old/(.*)=/new/$1', the first matching rule wins "+
+			"(repeatable)")
+	healthPathPtr := flag.String("health-path", "",
+		"Answer 200 on this path even in maintenance mode and 503 "+
+			"during -warmup, for load balancer health checks, with the "+
+			"number of requests in flight in X-In-Flight")
+	shutdownTimeoutPtr := flag.Duration("shutdown-timeout", 10*time.Second,
+		"Time to let in-flight requests finish on SIGINT or SIGTERM "+
+			"before their connections are closed")
+	memFSPtr := flag.Bool("memfs", false,
+		"Accept PUT and DELETE into an in-memory layer over the served "+
+			"files, changes are lost on restart and never touch the disk")
+	http3Ptr := flag.Bool("http3", false,
+		"Enable HTTP/3 server on the same UDP port (requires -tls)")
+	flag.Parse()
+	path = *pathPtr
+	host := *hostPtr
+	iface := *interfacePtr
+	port := *portPtr
+	cache := *cachePtr
+	tlsServer := *tlsServerPtr
+	contentType := *contentTypePtr
+	noKeepAlive := *noKeepAlivePtr
+	tcpKeepAlive := *tcpKeepAlivePtr
+	noDelay := *noDelayPtr
+	reusePort := *reusePortPtr
+	listingPerms := *listingPermsPtr
+	retryAfter := *retryAfterPtr
+	certPath := *certPtr
+	keyPath := *keyPtr
+	certEnv := *certEnvPtr
+	keyEnv := *keyEnvPtr
+	ocspStaple := *ocspStaplePtr
+	ciphers := *ciphersPtr
+	listingFilter := *listingFilterPtr
+	maskForbidden := *maskForbiddenPtr
+	optInListing := *optInListingPtr
+	slowThreshold := *slowThresholdPtr
+	listingMaxEntries := *listingMaxEntriesPtr
+	noSessionTickets := *noSessionTicketsPtr
+	sessionTicketKeys := *sessionTicketKeysPtr
+	sitemap := *sitemapPtr
+	baseURL := *baseURLPtr
+	csp := *cspPtr
+	cspNonce := *cspNoncePtr
+	vhostStrict := *vhostStrictPtr
+	safeRecovery := *safeRecoveryPtr
+	debugMode := *debugPtr
+	gzipListing := *gzipListingPtr
+	maxPathLen := *maxPathLenPtr
+	listingTitle := *listingTitlePtr
+	listingFooter := *listingFooterPtr
+	listingFooterHtml := *listingFooterHtmlPtr
+	logSample := *logSamplePtr
+	xAccel := *xAccelPtr
+	xSendfile := *xSendfilePtr
+	checksums := *checksumsPtr
+	groupByType := *groupByTypePtr
+	warmupDuration := *warmupPtr
+	compressLevelStr := *compressLevelPtr
+	markdownIndexStr := *markdownIndexPtr
+	snapshot := *snapshotPtr
+	allowForceListing := *allowForceListingPtr
+	canonicalHost := *canonicalHostPtr
+	thumbnails := *thumbnailsPtr
+	i18n := *i18nPtr
+	rateLimitBytes := *rateLimitBytesPtr
+	listingTemplatePath := *listingTemplatePtr
+	redirectCode := *redirectCodePtr
+	manifestPath := *manifestPtr
+	logVhost := *logVhostPtr
+	debugConfigAddr := *debugConfigPtr
+	maxSymlinkDepth := *maxSymlinkDepthPtr
+	hideSizes := *hideSizesPtr
+	errorFormat := *errorFormatPtr
+	strictSlash := *strictSlashPtr
+	strictSlash404 := *strictSlash404Ptr
+	logFilePath := *logFilePathPtr
+	emptyDir := *emptyDirPtr
+	noDefaultMiddleware := *noDefaultMiddlewarePtr
+	laxPaths := *laxPathsPtr
+	gitSafe := *gitSafePtr
+	maxOpenFiles := *maxOpenFilesPtr
+	maxOpenFilesReject := *maxOpenFilesRejectPtr
+	singleFile := *singleFilePtr
+	fileMetaHeaders := *fileMetaHeadersPtr
+	fileModeHeader := *fileModeHeaderPtr
+	liveReload := *liveReloadPtr
+	corp := *corpPtr
+	coop := *coopPtr
+	coep := *coepPtr
+	gzipListingCache := *gzipListingCachePtr
+	robots := *robotsPtr
+	padTo := *padToPtr
+	digest := strings.ToLower(*digestPtr)
+	logTLS := *logTLSPtr
+	createRoot := *createRootPtr
+	relativeTime := *relativeTimePtr
+	ownerUid := *ownerUidPtr
+	meta := *metaPtr
+	maxConnsPerIp := *maxConnsPerIpPtr
+	bandwidthQuota := *bandwidthQuotaPtr
+	quotaReset := *quotaResetPtr
+	caseFold := *caseFoldPtr
+	earlyHints := *earlyHintsPtr
+	naturalSort := *naturalSortPtr
+	maxDepth := *maxDepthPtr
+	selfCertKeyType := *selfCertKeyTypePtr
+	selfCertValidity := *selfCertValidityPtr
+	exportCa := *exportCaPtr
+	backlog := *backlogPtr
+	cas := *casPtr
+	casPrefixStr := *casPrefixPtr
+	noColor := *noColorPtr
+	healthPath := *healthPathPtr
+	shutdownTimeout := *shutdownTimeoutPtr
+	memFS := *memFSPtr
+	http3Server := *http3Ptr
+
+	if (certPath != "" || keyPath != "") && !tlsServer {
+		panic(errors.New("-cert and -key require -tls"))
+	}
+	if (certPath == "") != (keyPath == "") {
+		panic(errors.New("-cert and -key must be used together"))
+	}
+	if (certEnv != "" || keyEnv != "") && !tlsServer {
+		panic(errors.New("-cert-env and -key-env require -tls"))
+	}
+	if (certEnv == "") != (keyEnv == "") {
+		panic(errors.New("-cert-env and -key-env must be used together"))
+	}
+	if certEnv != "" && certPath != "" {
+		panic(errors.New("-cert-env cannot be combined with -cert"))
+	}
+	if ocspStaple != "" && certPath == "" && certEnv == "" {
+		panic(errors.New("-ocsp-staple requires -cert or -cert-env"))
+	}
+	if _, ok := selfCertSigAlgos[selfCertKeyType]; !ok {
+		panic(fmt.Errorf("invalid -selfcert-key-type %s", selfCertKeyType))
+	}
+	if selfCertValidity <= 0 {
+		panic(errors.New("-selfcert-validity must be positive"))
+	}
+	if exportCa != "" && !tlsServer {
+		panic(errors.New("-export-ca requires -tls"))
+	}
+	if exportCa != "" && (certPath != "" || certEnv != "") {
+		panic(errors.New(
+			"-export-ca cannot be combined with -cert or -cert-env"))
+	}
+
+	if cspNonce && csp == "" {
+		panic(errors.New("-csp-nonce requires -csp"))
+	}
+
+	if xAccel != "" && xSendfile {
+		panic(errors.New("-x-accel and -x-sendfile cannot be combined"))
+	}
+
+	if sitemap && baseURL == "" {
+		panic(errors.New("-sitemap requires -base-url"))
+	}
+
+	for _, pattern := range hideFromListing {
+		_, err = filepath.Match(pattern, "")
+		if err != nil {
+			panic(fmt.Errorf("invalid -hide-from-listing %s: %w",
+				pattern, err))
+		}
+	}
+
+	markdownIndex := []string{}
+	for _, name := range strings.Split(markdownIndexStr, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			markdownIndex = append(markdownIndex, name)
+		}
+	}
+
+	compressLevel, err := parseCompressLevel(compressLevelStr)
+	if err != nil {
+		panic(err)
+	}
+
+	cacheControls, err := parseCacheRules(cacheRules)
+	if err != nil {
+		panic(err)
+	}
+
+	preloadRules, err := parsePreloadRules(preloads)
+	if err != nil {
+		panic(err)
+	}
+
+	rewriteRules, err := parseRewriteRules(rewrites)
+	if err != nil {
+		panic(err)
+	}
+
+	var cipherSuites []uint16
+	if ciphers != "" {
+		cipherSuites, err = parseCipherSuites(ciphers)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var listingTemplate *template.Template
+	if listingTemplatePath != "" {
+		listingTemplate, err = template.ParseFiles(listingTemplatePath)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	switch redirectCode {
+	case 301, 302, 307, 308:
+	default:
+		panic(fmt.Errorf("invalid -redirect-code %d", redirectCode))
+	}
+
+	switch corp {
+	case "", "same-site", "same-origin", "cross-origin":
+	default:
+		panic(fmt.Errorf("invalid -corp %s", corp))
+	}
+
+	switch coop {
+	case "", "unsafe-none", "same-origin-allow-popups", "same-origin",
+		"noopener-allow-popups":
+	default:
+		panic(fmt.Errorf("invalid -coop %s", coop))
+	}
+
+	switch coep {
+	case "", "unsafe-none", "require-corp", "credentialless":
+	default:
+		panic(fmt.Errorf("invalid -coep %s", coep))
+	}
+
+	if robots != "" && robots != "allow" && robots != "deny" {
+		robots, err = filepath.Abs(robots)
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = os.Stat(robots)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if logTLS && !tlsServer {
+		panic(errors.New("-log-tls requires -tls"))
+	}
+
+	if digest != "" && digestAlgos[digest] == "" {
+		panic(fmt.Errorf("invalid -digest %s", digest))
+	}
+
+	if padTo < 0 || padTo > 16384 {
+		panic(errors.New("-pad-to must be between 0 and 16384"))
+	}
+
+	if gzipListingCache && !gzipListing {
+		panic(errors.New("-gzip-listing-cache requires -gzip-listing"))
+	}
+
+	if fileModeHeader && !fileMetaHeaders {
+		panic(errors.New("-file-mode-header requires -file-meta-headers"))
+	}
+
+	if earlyHints && len(preloads) == 0 {
+		panic(errors.New("-early-hints requires -preload"))
+	}
+
+	if healthPath != "" && !strings.HasPrefix(healthPath, "/") {
+		panic(errors.New("-health-path must start with /"))
+	}
+
+	if shutdownTimeout < 0 {
+		panic(errors.New("-shutdown-timeout cannot be negative"))
+	}
+
+	casPrefixStr = "/" + strings.Trim(casPrefixStr, "/") + "/"
+	if casPrefixStr == "//" {
+		panic(errors.New("-cas-prefix cannot be the root"))
+	}
+
+	if backlog < 0 {
+		panic(errors.New("-backlog cannot be negative"))
+	}
+
+	if maxDepth < 0 {
+		panic(errors.New("-max-depth cannot be negative"))
+	}
+
+	if maxOpenFiles < 0 {
+		panic(errors.New("-max-open-files cannot be negative"))
+	}
+	if maxOpenFilesReject && maxOpenFiles == 0 {
+		panic(errors.New("-max-open-files-reject requires -max-open-files"))
+	}
+
+	var fileLimit *FileLimiter
+	if maxOpenFiles > 0 {
+		fileLimit = &FileLimiter{
+			Reject:     maxOpenFilesReject,
+			RetryAfter: retryAfter,
+			sem:        make(chan struct{}, maxOpenFiles),
 		}
-		data += item.Formatted
 	}
-	return
-}
 
-type StaticHandler struct {
-	Root        string
-	Cache       bool
-	ContentType string
-	fileServer  http.Handler
-}
+	if maxConnsPerIp < 0 {
+		panic(errors.New("-max-conns-per-ip cannot be negative"))
+	}
 
-func (h *StaticHandler) Handle(c *gin.Context) {
-	if !h.Cache {
-		c.Writer.Header().Add("Cache-Control",
-			"no-cache, no-store, must-revalidate")
-		c.Writer.Header().Add("Pragma", "no-cache")
-		c.Writer.Header().Add("Expires", "0")
+	if quotaReset < 0 {
+		panic(errors.New("-quota-reset cannot be negative"))
 	}
 
-	path := filepath.Join(h.Root, filepath.FromSlash(
-		filepath.Clean("/"+c.Param("filepath"))))
+	var quota *Quota
+	if bandwidthQuota > 0 {
+		quota = &Quota{
+			Limit:      bandwidthQuota,
+			Reset:      quotaReset,
+			RetryAfter: retryAfter,
+		}
+		quota.Start()
+	}
 
-	isDir, err := IsDirectory(path)
-	if err != nil {
-		c.AbortWithError(500, err)
-		return
+	if noDefaultMiddleware && safeRecovery {
+		panic(errors.New(
+			"-safe-recovery cannot be combined with -no-default-middleware"))
 	}
 
-	ok := false
-	if isDir {
-		ok, err = h.HandleDirList(path, c)
-		if err != nil {
-			c.AbortWithError(500, err)
-			return
-		}
+	switch emptyDir {
+	case "listing", "404", "message":
+	default:
+		panic(fmt.Errorf("invalid -empty-dir %s", emptyDir))
 	}
 
-	if !ok {
-		if h.ContentType != "" {
-			c.Writer.Header().Add("Content-Type", h.ContentType)
-		}
-		h.fileServer.ServeHTTP(c.Writer, c.Request)
+	if strictSlash404 && !strictSlash {
+		panic(errors.New("-strict-slash-404 requires -strict-slash"))
 	}
-}
 
-func (h *StaticHandler) HandleDirList(path string, c *gin.Context) (
-	ok bool, err error) {
+	if errorFormat != "text" && errorFormat != "json" {
+		panic(fmt.Errorf("invalid -error-format %s", errorFormat))
+	}
 
-	pathFrm := filepath.Clean("/" + c.Param("filepath"))
-	if !strings.HasSuffix(pathFrm, "/") {
-		pathFrm += "/"
+	switch hideSizes {
+	case "", "category", "hidden":
+	default:
+		panic(fmt.Errorf("invalid -hide-sizes %s", hideSizes))
 	}
 
-	if !strings.HasSuffix(c.Request.URL.Path, "/") {
-		c.Redirect(301, c.Request.URL.Path+"/")
+	if maxSymlinkDepth < 1 {
+		panic(errors.New("-max-symlink-depth must be at least 1"))
+	}
+
+	if rateLimitBytes < 0 {
+		panic(errors.New("-rate-limit-bytes cannot be negative"))
 	}
 
-	items := &Items{}
+	if http3Server && !tlsServer {
+		panic(errors.New("-http3 requires -tls"))
+	}
 
-	itemsAll, err := ioutil.ReadDir(path)
+	path, err = filepath.Abs(path)
 	if err != nil {
-		return
+		panic(err)
 	}
 
-	for _, item := range itemsAll {
-		name := item.Name()
-		if name == "index.html" {
-			return
+	if createRoot {
+		exists, err := Exists(path)
+		if err != nil {
+			panic(err)
 		}
 
-		modTime := item.ModTime().Format("02-Jan-2006 15:04")
-
-		if item.Mode()&os.ModeSymlink != 0 {
-			linkPath, e := os.Readlink(filepath.Join(path, item.Name()))
-			if e != nil {
-				err = e
-				return
+		if !exists {
+			err = os.MkdirAll(path, 0755)
+			if err != nil {
+				panic(err)
 			}
+		}
+	}
 
-			itm, e := os.Lstat(linkPath)
-			if e != nil {
-				if os.IsNotExist(e) {
-					continue
-				}
-				err = e
-				return
-			}
-			item = itm
+	if snapshot {
+		path, err = filepath.EvalSymlinks(path)
+		if err != nil {
+			panic(err)
 		}
+	}
 
-		size := ""
-		if item.IsDir() {
-			name += "/"
-			size = "-"
-		} else {
-			size = fmt.Sprintf("%d", item.Size())
+	rootInfo, err := os.Stat(path)
+	if err != nil {
+		panic(err)
+	}
+	if !rootInfo.IsDir() && !singleFile {
+		panic(fmt.Errorf("%s is not a directory, use -single-file to "+
+			"serve it for every request", path))
+	}
+	if rootInfo.IsDir() {
+		singleFile = false
+	}
+	if singleFile && len(overlays) > 0 {
+		panic(errors.New("-overlay cannot be used when -path is a file"))
+	}
+	if singleFile && memFS {
+		panic(errors.New("-memfs cannot be used when -path is a file"))
+	}
+
+	var manifest map[string][]byte
+	if manifestPath != "" {
+		manifestBase := path
+		if singleFile {
+			manifestBase = filepath.Dir(path)
+		}
+		manifest, err = parseManifest(manifestPath, manifestBase)
+		if err != nil {
+			panic(err)
 		}
+	}
 
-		formattedName := name
-		if len(formattedName) > 50 {
-			formattedName = formattedName[:47] + "..>"
+	overlayPaths := []string{}
+	for _, overlay := range overlays {
+		overlayPath, err := filepath.Abs(overlay)
+		if err != nil {
+			panic(err)
 		}
 
-		items.Add(Item{
-			Name:  name,
-			IsDir: item.IsDir(),
-			Formatted: fmt.Sprintf(
-				`<a href="%s">`, name) + fmt.Sprintf(
-				"%-54s %s %19s", formattedName+"</a>", modTime, size),
-		})
-	}
+		if snapshot {
+			overlayPath, err = filepath.EvalSymlinks(overlayPath)
+			if err != nil {
+				panic(err)
+			}
+		}
 
-	items.Sort()
+		overlayPaths = append(overlayPaths, overlayPath)
+	}
 
-	ok = true
-	data := []byte(fmt.Sprintf(body, pathFrm, pathFrm, items.Join("\n")))
-	c.Data(200, "text/html", data)
+	static := &StaticHandler{
+		Root:              path,
+		Cache:             cache,
+		ContentType:       contentType,
+		ListingPerms:      listingPerms,
+		ListingFilter:     listingFilter,
+		MaskForbidden:     maskForbidden,
+		OptInListing:      optInListing,
+		ListingMaxEntries: listingMaxEntries,
+		HideFromListing:   hideFromListing,
+		Sitemap:           sitemap,
+		BaseURL:           baseURL,
+		CacheRules:        cacheControls,
+		CSP:               csp,
+		CSPNonce:          cspNonce,
+		GzipListing:       gzipListing,
+		CompressLevel:     compressLevel,
+		ListingTitle:      listingTitle,
+		ListingFooter:     listingFooter,
+		ListingFooterHtml: listingFooterHtml,
+		XAccelRedirect:    xAccel,
+		XSendfile:         xSendfile,
+		Checksums:         checksums,
+		GroupByType:       groupByType,
+		MarkdownIndex:     markdownIndex,
+		AllowForceListing: allowForceListing,
+		Thumbnails:        thumbnails,
+		I18n:              i18n,
+		Preload:           preloadRules,
+		RateLimitBytes:    rateLimitBytes,
+		ListingTemplate:   listingTemplate,
+		RedirectCode:      redirectCode,
+		Manifest:          manifest,
+		Overlays:          overlayPaths,
+		MaxSymlinkDepth:   maxSymlinkDepth,
+		HideSizes:         hideSizes,
+		StrictSlash:       strictSlash,
+		StrictSlash404:    strictSlash404,
+		LogFilePath:       logFilePath,
+		EmptyDir:          emptyDir,
+		LaxPaths:          laxPaths,
+		GitSafe:           gitSafe,
+		FileLimit:         fileLimit,
+		Quota:             quota,
+		CaseFold:          caseFold,
+		EarlyHints:        earlyHints,
+		NaturalSort:       naturalSort,
+		MaxDepth:          maxDepth,
+		CAS:               cas,
+		CASPrefix:         casPrefixStr,
+		MemFS:             memFS,
+		SingleFile:        singleFile,
+		FileMetaHeaders:   fileMetaHeaders,
+		FileModeHeader:    fileModeHeader,
+		LiveReload:        liveReload,
+		GzipListingCache:  gzipListingCache,
+		Robots:            robots,
+		PadTo:             padTo,
+		Digest:            digest,
+		RelativeTime:      relativeTime,
+		OwnerUid:          ownerUid,
+		Meta:              meta,
+	}
 
-	return
-}
+	if debugMode {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	if noColor {
+		gin.DisableConsoleColor()
+	}
+	router := gin.New()
 
-func (h *StaticHandler) Setup(engine *gin.Engine) {
-	fs := gin.Dir(h.Root, false)
-	h.fileServer = http.StripPrefix("/", http.FileServer(fs))
+	addr := fmt.Sprintf("%s:%d", host, port)
 
-	engine.GET("/*filepath", h.Handle)
-	engine.HEAD("/*filepath", h.Handle)
+	var h3Server *http3.Server
+	if http3Server {
+		h3Server = &http3.Server{
+			Addr:    addr,
+			Port:    port,
+			Handler: optionsAsterisk(router),
+		}
 
-	return
-}
+		router.Use(func(c *gin.Context) {
+			if c.Request.ProtoMajor < 3 {
+				_ = h3Server.SetQUICHeaders(c.Writer.Header())
+			}
+		})
+	}
 
-func selfCert(parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (
-	cert *x509.Certificate, certByt []byte, certKey *ecdsa.PrivateKey,
-	err error) {
+	if !noDefaultMiddleware {
+		accessLogger := &AccessLogger{
+			Sample:   logSample,
+			Vhost:    logVhost,
+			FilePath: logFilePath,
+			TLS:      logTLS,
+		}
+		router.Use(gin.LoggerWithFormatter(accessLogger.Format))
+	}
+	if errorFormat == "json" {
+		router.Use(JSONErrors)
+	}
+	if !noDefaultMiddleware {
+		if safeRecovery {
+			router.Use(SafeRecovery)
+		} else {
+			router.Use(gin.Recovery())
+		}
+	}
 
-	certKey, err = ecdsa.GenerateKey(
-		elliptic.P384(),
-		rand.Reader,
-	)
-	if err != nil {
-		return
+	securityHeaders := &SecurityHeaders{
+		Headers: map[string]string{},
+	}
+	if corp != "" {
+		securityHeaders.Headers["Cross-Origin-Resource-Policy"] = corp
+	}
+	if coop != "" {
+		securityHeaders.Headers["Cross-Origin-Opener-Policy"] = coop
+	}
+	if coep != "" {
+		securityHeaders.Headers["Cross-Origin-Embedder-Policy"] = coep
+	}
+	if len(securityHeaders.Headers) > 0 {
+		router.Use(securityHeaders.Handle)
 	}
 
-	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serial, err := rand.Int(rand.Reader, serialLimit)
-	if err != nil {
-		return
+	if maxPathLen > 0 {
+		pathLimit := &PathLimit{
+			MaxLen: maxPathLen,
+		}
+		router.Use(pathLimit.Handle)
 	}
 
-	certTempl := &x509.Certificate{
-		SerialNumber: serial,
-		Subject: pkix.Name{
-			Organization: []string{"Pacur HTTP Server"},
-		},
-		NotBefore: time.Now().Add(-24 * time.Hour),
-		NotAfter:  time.Now().Add(26280 * time.Hour),
-		KeyUsage: x509.KeyUsageKeyEncipherment |
-			x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		BasicConstraintsValid: true,
-		SignatureAlgorithm:    x509.ECDSAWithSHA256,
+	var warmup *Warmup
+	if warmupDuration > 0 {
+		warmup = &Warmup{
+			RetryAfter: retryAfter,
+		}
+		warmup.Start(warmupDuration)
 	}
 
-	if parent == nil {
-		parent = certTempl
-		parentKey = certKey
+	inFlight := &InFlight{}
+	if healthPath != "" {
+		health := &HealthCheck{
+			Path:     healthPath,
+			Warmup:   warmup,
+			InFlight: inFlight,
+		}
+		router.Use(health.Handle)
 	}
+	router.Use(inFlight.Handle)
 
-	certByt, err = x509.CreateCertificate(rand.Reader, certTempl, parent,
-		certKey.Public(), parentKey)
-	if err != nil {
-		return
+	if canonicalHost != "" {
+		canonical := &CanonicalHost{
+			Host: canonicalHost,
+		}
+		router.Use(canonical.Handle)
 	}
 
-	cert, err = x509.ParseCertificate(certByt)
-	if err != nil {
-		return
+	if slowThreshold > 0 {
+		slowLogger := &SlowLogger{
+			Threshold: slowThreshold,
+		}
+		router.Use(slowLogger.Handle)
 	}
 
-	return
-}
+	if maxConnsPerIp > 0 {
+		connLimiter := &ConnLimiter{
+			Max:        maxConnsPerIp,
+			RetryAfter: retryAfter,
+		}
+		router.Use(connLimiter.Handle)
+	}
 
-func main() {
-	path, err := os.Getwd()
-	if err != nil {
-		panic(err)
+	if quota != nil {
+		router.Use(quota.Handle)
 	}
 
-	pathPtr := flag.String("path", path, "Path to serve")
-	hostPtr := flag.String("host", "[::]", "Server host")
-	portPtr := flag.Int("port", 8000, "Server port number")
-	cachePtr := flag.Bool("cache", false, "Enable cache")
-	tlsServerPtr := flag.Bool("tls", false, "Enable TLS server")
-	contentTypePtr := flag.String("type", "", "Force content type")
-	flag.Parse()
-	path = *pathPtr
-	host := *hostPtr
-	port := *portPtr
-	cache := *cachePtr
-	tlsServer := *tlsServerPtr
-	contentType := *contentTypePtr
+	maintenance := &Maintenance{
+		RetryAfter: retryAfter,
+	}
+	watchMaintenance(maintenance)
+	router.Use(maintenance.Handle)
 
-	path, err = filepath.Abs(path)
-	if err != nil {
-		panic(err)
+	if warmup != nil {
+		router.Use(warmup.Handle)
 	}
 
-	static := &StaticHandler{
-		Root:        path,
-		Cache:       cache,
-		ContentType: contentType,
+	if len(rewriteRules) > 0 {
+		rewriter := &Rewriter{
+			Rules: rewriteRules,
+		}
+		router.Use(rewriter.Handle)
 	}
 
-	gin.SetMode(gin.ReleaseMode)
-	router := gin.New()
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	if len(vhosts) > 0 {
+		virtualHosts := &VirtualHosts{
+			Hosts:  map[string]*StaticHandler{},
+			Strict: vhostStrict,
+		}
+
+		for _, vhost := range vhosts {
+			parts := strings.SplitN(vhost, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				panic(fmt.Errorf("invalid vhost %s", vhost))
+			}
+
+			vhostPath, err := filepath.Abs(parts[1])
+			if err != nil {
+				panic(err)
+			}
+
+			if snapshot {
+				vhostPath, err = filepath.EvalSymlinks(vhostPath)
+				if err != nil {
+					panic(err)
+				}
+			}
+
+			virtualHosts.Hosts[strings.ToLower(parts[0])] =
+				static.VirtualHost(vhostPath)
+		}
+
+		router.Use(virtualHosts.Handle)
+	}
 
 	static.Setup(router)
 
@@ -321,45 +3613,121 @@ func main() {
 	} else {
 		scheme = "http"
 	}
-	fmt.Printf("Listening and serving %s on %s://%s:%d\n",
-		path, scheme, host, port)
-
-	server := http.Server{
-		Addr:    fmt.Sprintf("%s:%d", host, port),
-		Handler: router,
-	}
 
-	if tlsServer {
-		caCert, _, caKey, err := selfCert(nil, nil)
+	addrs := []string{addr}
+	if iface != "" {
+		addrs, err = interfaceAddrs(iface, port)
 		if err != nil {
 			panic(err)
 		}
+	}
+
+	listenNote := ""
+	if backlog > 0 && backlogSupported {
+		listenNote = fmt.Sprintf(" with backlog %d", backlog)
+	}
+	for _, listenAddr := range addrs {
+		fmt.Printf("Listening and serving %s on %s://%s%s\n",
+			path, scheme, listenAddr, listenNote)
+	}
 
-		_, certByt, certKey, err := selfCert(caCert, caKey)
+	if debugConfigAddr != "" {
+		err = serveDebugConfig(debugConfigAddr, static)
 		if err != nil {
 			panic(err)
 		}
+		fmt.Printf("Serving debug config on http://%s/config\n",
+			debugConfigAddr)
+	}
+
+	server := http.Server{
+		Addr:                         addr,
+		Handler:                      optionsAsterisk(router),
+		DisableGeneralOptionsHandler: true,
+		ConnState:                    inFlight.ConnState,
+	}
+
+	if noKeepAlive {
+		server.SetKeepAlivesEnabled(false)
+	}
+
+	listenConfig := net.ListenConfig{
+		KeepAlive: tcpKeepAlive,
+	}
+
+	if reusePort {
+		if reusePortSupported {
+			listenConfig.Control = reusePortControl
+		} else {
+			fmt.Println("Warning: -reuseport is not supported " +
+				"on this platform")
+		}
+	}
+
+	if backlog > 0 && !backlogSupported {
+		fmt.Println("Warning: -backlog is not supported " +
+			"on this platform")
+	}
 
-		certKeyByte, err := x509.MarshalECPrivateKey(certKey)
+	listeners := []net.Listener{}
+	errChan := make(chan error, 2*len(addrs))
+	for _, listenAddr := range addrs {
+		listener, err := listenConfig.Listen(
+			context.Background(), "tcp", listenAddr)
 		if err != nil {
 			panic(err)
 		}
 
-		certKeyBlock := &pem.Block{
-			Type:  "EC PRIVATE KEY",
-			Bytes: certKeyByte,
+		if backlog > 0 && backlogSupported {
+			err = setBacklog(listener, backlog)
+			if err != nil {
+				panic(err)
+			}
 		}
-		keyPem := pem.EncodeToMemory(certKeyBlock)
 
-		certBlock := &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: certByt,
+		if !noDelay {
+			listener = &noDelayListener{
+				Listener: listener,
+				noDelay:  noDelay,
+			}
 		}
-		certPem := pem.EncodeToMemory(certBlock)
 
-		keypair, err := tls.X509KeyPair(certPem, keyPem)
-		if err != nil {
-			return
+		listeners = append(listeners, listener)
+	}
+
+	if tlsServer {
+		var keypair tls.Certificate
+		if certPath != "" {
+			keypair, err = tls.LoadX509KeyPair(certPath, keyPath)
+			if err != nil {
+				panic(err)
+			}
+		} else if certEnv != "" {
+			keypair, err = envKeyPair(certEnv, keyEnv)
+			if err != nil {
+				panic(err)
+			}
+		} else {
+			var caPem []byte
+			keypair, caPem, err = selfKeyPair(selfCertKeyType,
+				selfCertValidity)
+			if err != nil {
+				panic(err)
+			}
+
+			if exportCa != "" {
+				err = ioutil.WriteFile(exportCa, caPem, 0644)
+				if err != nil {
+					panic(err)
+				}
+			}
+		}
+
+		if ocspStaple != "" {
+			keypair.OCSPStaple, err = ioutil.ReadFile(ocspStaple)
+			if err != nil {
+				panic(err)
+			}
 		}
 
 		tlsConfig := &tls.Config{
@@ -368,20 +3736,88 @@ func main() {
 			Certificates: []tls.Certificate{
 				keypair,
 			},
+			CipherSuites:           cipherSuites,
+			SessionTicketsDisabled: noSessionTickets,
 		}
 
-		listener, err := tls.Listen("tcp", server.Addr, tlsConfig)
-		if err != nil {
-			panic(err)
-			return
+		if sessionTicketKeys != "" {
+			keys, err := loadSessionTicketKeys(sessionTicketKeys)
+			if err != nil {
+				panic(err)
+			}
+			tlsConfig.SetSessionTicketKeys(keys)
+		}
+
+		for i, listener := range listeners {
+			listeners[i] = tls.NewListener(listener, tlsConfig)
+		}
+
+		if h3Server != nil {
+			h3Server.TLSConfig = tlsConfig
+
+			for _, listenAddr := range addrs {
+				conn, err := net.ListenPacket("udp", listenAddr)
+				if err != nil {
+					panic(err)
+				}
+
+				go func() {
+					errChan <- h3Server.Serve(conn)
+				}()
+			}
 		}
+	}
+
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errChan <- server.Serve(listener)
+		}(listener)
+	}
 
-		err = server.Serve(listener)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err = <-errChan:
 		if err != nil {
 			panic(err)
 		}
-	} else {
-		err = server.ListenAndServe()
+	case <-sigChan:
+		fmt.Printf("Shutting down with %d requests in flight\n",
+			inFlight.Requests())
+
+		if h3Server != nil {
+			_ = h3Server.Close()
+		}
+
+		deadline := time.Now().Add(shutdownTimeout)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					fmt.Printf("Shutting down in %s, %d requests in flight\n",
+						time.Until(deadline).Round(time.Second),
+						inFlight.Requests())
+				}
+			}
+		}()
+
+		err = server.Shutdown(ctx)
+		close(done)
+		if err == context.DeadlineExceeded {
+			fmt.Printf("Shutdown timed out, closing %d connections\n",
+				inFlight.Conns())
+			err = server.Close()
+		}
 		if err != nil {
 			panic(err)
 		}
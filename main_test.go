@@ -0,0 +1,1677 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestHandler(root string) *StaticHandler {
+	return &StaticHandler{
+		Root:            root,
+		CompressLevel:   gzip.DefaultCompression,
+		MaxSymlinkDepth: 8,
+		EmptyDir:        "listing",
+		OwnerUid:        -1,
+	}
+}
+
+func newTestRouter(h *StaticHandler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	h.Setup(router)
+	return router
+}
+
+func doRequest(router http.Handler, method string, target string,
+	body io.Reader) *httptest.ResponseRecorder {
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(method, target, body))
+	return resp
+}
+
+func writeTestFile(t testing.TB, root string, name string, data string) {
+	t.Helper()
+
+	path := filepath.Join(root, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "base.txt", "disk")
+	writeTestFile(t, root, "sub/keep.txt", "keep")
+
+	h := newTestHandler(root)
+	h.MemFS = true
+	router := newTestRouter(h)
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+		expect string
+	}{
+		{"PUT", "/base.txt", "memory", 204, ""},
+		{"GET", "/base.txt", "", 200, "memory"},
+		{"PUT", "/new/file.txt", "created", 201, ""},
+		{"GET", "/new/file.txt", "", 200, "created"},
+		{"GET", "/", "", 200, `href="new/"`},
+		{"GET", "/new/", "", 200, `href="file.txt"`},
+		{"GET", "/sub/", "", 200, `href="keep.txt"`},
+		{"PUT", "/sub", "x", 409, ""},
+		{"PUT", "/base.txt/x", "x", 409, ""},
+		{"PUT", "/sub/", "x", 400, ""},
+		{"DELETE", "/base.txt", "", 204, ""},
+		{"GET", "/base.txt", "", 404, ""},
+		{"DELETE", "/base.txt", "", 404, ""},
+		{"DELETE", "/new/file.txt", "", 204, ""},
+		{"GET", "/new/file.txt", "", 404, ""},
+		{"PUT", "/base.txt", "again", 201, ""},
+		{"GET", "/base.txt", "", 200, "again"},
+	}
+
+	for _, test := range tests {
+		resp := doRequest(router, test.method, test.target,
+			strings.NewReader(test.body))
+		if resp.Code != test.status {
+			t.Fatalf("%s %s: status %d, want %d", test.method, test.target,
+				resp.Code, test.status)
+		}
+		if !strings.Contains(resp.Body.String(), test.expect) {
+			t.Fatalf("%s %s: body %q does not contain %q", test.method,
+				test.target, resp.Body.String(), test.expect)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "base.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "disk" {
+		t.Fatalf("base file changed on disk: %q", data)
+	}
+	_, err = os.Stat(filepath.Join(root, "new"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("memory layer created a directory on disk: %v", err)
+	}
+}
+
+func TestMemFSListingHidesDeleted(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "gone.txt", "disk")
+
+	h := newTestHandler(root)
+	h.MemFS = true
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "DELETE", "/gone.txt", nil)
+	if resp.Code != 204 {
+		t.Fatalf("delete status %d", resp.Code)
+	}
+
+	resp = doRequest(router, "GET", "/", nil)
+	if strings.Contains(resp.Body.String(), "gone.txt") {
+		t.Fatalf("deleted file still listed: %s", resp.Body.String())
+	}
+}
+
+func TestMemFSVirtualHosts(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "a.txt", "disk")
+
+	static := newTestHandler(root)
+	static.MemFS = true
+
+	readOnly := *static
+	readOnly.MemFS = false
+	readOnly.Init()
+	writable := *static
+	writable.Init()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	vhosts := &VirtualHosts{
+		Hosts: map[string]*StaticHandler{
+			"ro.test": &readOnly,
+			"rw.test": &writable,
+		},
+	}
+	router.Use(vhosts.Handle)
+	static.Setup(router)
+
+	put := func(host string) int {
+		req := httptest.NewRequest("PUT", "/a.txt",
+			strings.NewReader("memory"))
+		req.Host = host
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := put("ro.test"); code != 405 {
+		t.Fatalf("read-only host accepted PUT: %d", code)
+	}
+	if code := put("rw.test"); code != 204 {
+		t.Fatalf("writable host rejected PUT: %d", code)
+	}
+
+	req := httptest.NewRequest("GET", "/a.txt", nil)
+	req.Host = "ro.test"
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Body.String() != "disk" {
+		t.Fatalf("write leaked into another host: %q", resp.Body.String())
+	}
+}
+
+func TestLiveReloadNonce(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.html", "<html><body>hi</body></html>")
+
+	h := newTestHandler(root)
+	h.LiveReload = true
+	h.CSP = "default-src 'self'; script-src 'self'"
+	h.CSPNonce = true
+	router := newTestRouter(h)
+	defer h.liveReload.watcher.Close()
+
+	for _, target := range []string{"/", "/index.html"} {
+		resp := doRequest(router, "GET", target, nil)
+		if resp.Code != 200 {
+			t.Fatalf("%s: status %d", target, resp.Code)
+		}
+
+		match := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(
+			resp.Header().Get("Content-Security-Policy"))
+		if match == nil {
+			t.Fatalf("%s: no nonce in policy %q", target,
+				resp.Header().Get("Content-Security-Policy"))
+		}
+		if !strings.Contains(resp.Body.String(),
+			`<script nonce="`+match[1]+`">`) {
+
+			t.Fatalf("%s: script does not carry the nonce: %s", target,
+				resp.Body.String())
+		}
+	}
+}
+
+func TestLiveReloadLimits(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.html", "<html><body>hi</body></html>")
+
+	h := newTestHandler(root)
+	h.LiveReload = true
+	h.Quota = &Quota{}
+	router := newTestRouter(h)
+	defer h.liveReload.watcher.Close()
+
+	resp := doRequest(router, "GET", "/index.html", nil)
+	if resp.Code != 503 {
+		t.Fatalf("exhausted quota served %d", resp.Code)
+	}
+}
+
+func TestCASPrefix(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "data.bin", "content")
+	writeTestFile(t, root, "blob/real.txt", "real")
+	sum := sha256.Sum256([]byte("content"))
+	key := hex.EncodeToString(sum[:])
+
+	h := newTestHandler(root)
+	h.CAS = true
+	h.CASPrefix = "/sha/"
+	router := newTestRouter(h)
+
+	var wait sync.WaitGroup
+	codes := make(chan int, 8)
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			codes <- doRequest(router, "GET", "/sha/"+key, nil).Code
+		}()
+	}
+	wait.Wait()
+	close(codes)
+	for code := range codes {
+		if code != 200 {
+			t.Fatalf("blob status %d", code)
+		}
+	}
+
+	resp := doRequest(router, "GET", "/blob/real.txt", nil)
+	if resp.Code != 200 || resp.Body.String() != "real" {
+		t.Fatalf("blob directory hidden: %d %q", resp.Code, resp.Body.String())
+	}
+
+	h.Quota = &Quota{}
+	resp = doRequest(router, "GET", "/sha/"+key, nil)
+	if resp.Code != 503 {
+		t.Fatalf("exhausted quota served blob: %d", resp.Code)
+	}
+}
+
+func TestListingCache(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "dir/a.txt", "1")
+
+	h := newTestHandler(root)
+	h.GzipListing = true
+	h.GzipListingCache = true
+	h.ListingFilter = true
+	h.CSP = "default-src 'self'"
+	h.CSPNonce = true
+	router := newTestRouter(h)
+
+	get := func() (body string, nonce string) {
+		req := httptest.NewRequest("GET", "/dir/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != 200 {
+			t.Fatalf("listing status %d", resp.Code)
+		}
+		if resp.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatal("listing not compressed")
+		}
+
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		match := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(
+			resp.Header().Get("Content-Security-Policy"))
+		if match == nil {
+			t.Fatal("no nonce in policy")
+		}
+		body = string(data)
+		nonce = match[1]
+		if !strings.Contains(body, `<script nonce="`+nonce+`">`) {
+			t.Fatalf("listing script does not carry the nonce: %s", body)
+		}
+		return
+	}
+
+	first, firstNonce := get()
+	if !strings.Contains(first, " 1\n</span>") {
+		t.Fatalf("unexpected listing: %s", first)
+	}
+
+	writeTestFile(t, root, "dir/a.txt", "12345")
+	cached, cachedNonce := get()
+	if cachedNonce == firstNonce {
+		t.Fatal("nonce reused across requests")
+	}
+	if strings.ReplaceAll(cached, cachedNonce, firstNonce) != first {
+		t.Fatalf("listing regenerated without a directory change: %s",
+			cached)
+	}
+
+	later := time.Now().Add(time.Minute)
+	err := os.Chtimes(filepath.Join(root, "dir"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := get()
+	if !strings.Contains(fresh, " 5\n</span>") {
+		t.Fatalf("listing not invalidated by the directory modtime: %s",
+			fresh)
+	}
+}
+
+func TestRateLimitPerConnection(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "a.bin", strings.Repeat("a", 1000))
+	writeTestFile(t, root, "b.bin", strings.Repeat("b", 1000))
+
+	h := newTestHandler(root)
+	h.RateLimitBytes = 2000
+	router := newTestRouter(h)
+
+	download := func(addrs ...string) time.Duration {
+		start := time.Now()
+		var wait sync.WaitGroup
+		for i, addr := range addrs {
+			req := httptest.NewRequest("GET", []string{"/a.bin", "/b.bin"}[i],
+				nil)
+			req.RemoteAddr = addr
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				resp := httptest.NewRecorder()
+				router.ServeHTTP(resp, req)
+				if resp.Body.Len() != 1000 {
+					t.Errorf("short body %d", resp.Body.Len())
+				}
+			}()
+		}
+		wait.Wait()
+		return time.Since(start)
+	}
+
+	shared := download("192.0.2.1:1000", "192.0.2.1:1000")
+	if shared < 700*time.Millisecond {
+		t.Fatalf("one connection got more than the rate: %s", shared)
+	}
+
+	separate := download("192.0.2.1:1000", "192.0.2.1:1001")
+	if separate > 700*time.Millisecond {
+		t.Fatalf("separate connections shared a limit: %s", separate)
+	}
+}
+
+func TestListingMaxEntries(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 50; i++ {
+		writeTestFile(t, root, fmt.Sprintf("big/%02d.txt", i), "x")
+	}
+	writeTestFile(t, root, "big/.hidden", "x")
+	err := os.Symlink("missing", filepath.Join(root, "big", "00-broken"))
+	if err != nil {
+		t.Skipf("symlinks unavailable: %s", err)
+	}
+
+	h := newTestHandler(root)
+	h.ListingMaxEntries = 10
+	h.HideFromListing = []string{".*"}
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "GET", "/big/", nil)
+	if resp.Code != 200 {
+		t.Fatalf("listing status %d", resp.Code)
+	}
+	if count := strings.Count(resp.Body.String(), `.txt">`); count != 10 {
+		t.Fatalf("listing shows %d entries, want 10", count)
+	}
+	for i := 0; i < 50; i++ {
+		shown := strings.Contains(resp.Body.String(),
+			fmt.Sprintf(`href="%02d.txt"`, i))
+		if shown != (i < 10) {
+			t.Fatalf("entry %02d shown %t, want the first 10 by name", i,
+				shown)
+		}
+	}
+	if !strings.Contains(resp.Body.String(),
+		"Showing first 10 of 50 entries") {
+
+		t.Fatalf("missing truncation notice: %s", resp.Body.String())
+	}
+
+	resp = doRequest(router, "GET", "/big/?json", nil)
+	listing := &jsonListing{}
+	err = json.Unmarshal(resp.Body.Bytes(), listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listing.Total != 50 || !listing.Truncated || len(listing.Items) != 10 {
+		t.Fatalf("json total %d truncated %t items %d", listing.Total,
+			listing.Truncated, len(listing.Items))
+	}
+
+	writeTestFile(t, root, "big/index.html", "index")
+	resp = doRequest(router, "GET", "/big/", nil)
+	if resp.Body.String() != "index" {
+		t.Fatalf("index past the entry limit not served: %s",
+			resp.Body.String())
+	}
+}
+
+func TestMaliciousPaths(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "www")
+	writeTestFile(t, root, "public.txt", "public")
+	writeTestFile(t, parent, "secret.txt", "secret")
+
+	router := newTestRouter(newTestHandler(root))
+
+	targets := []string{
+		"/../secret.txt",
+		"/../../secret.txt",
+		"/public.txt/../../secret.txt",
+		"/%2e%2e/secret.txt",
+		"/%2e%2e%2fsecret.txt",
+		"/..%2f..%2fsecret.txt",
+		"/%2e%2e%5csecret.txt",
+		"/..\\secret.txt",
+		"/..%5c..%5csecret.txt",
+		"/public.txt%00",
+		"/%00/../secret.txt",
+		"/public%0a.txt",
+		"/%7f",
+	}
+
+	for _, target := range targets {
+		resp := doRequest(router, "GET", target, nil)
+		if resp.Code != 400 && resp.Code != 404 {
+			t.Errorf("%s: status %d, want 400 or 404", target, resp.Code)
+		}
+		if strings.Contains(resp.Body.String(), "secret") {
+			t.Errorf("%s: served a file outside the root", target)
+		}
+	}
+
+	resp := doRequest(router, "GET", "/public.txt%00", nil)
+	if resp.Code != 400 {
+		t.Errorf("NUL byte: status %d, want 400", resp.Code)
+	}
+
+	resp = doRequest(router, "GET", "/public.txt", nil)
+	if resp.Code != 200 || resp.Body.String() != "public" {
+		t.Fatalf("safe path: status %d body %q", resp.Code,
+			resp.Body.String())
+	}
+}
+
+func TestListingHrefs(t *testing.T) {
+	tests := []struct {
+		name string
+		href string
+	}{
+		{"a b.txt", "a%20b.txt"},
+		{"a#b.txt", "a%23b.txt"},
+		{"a+b.txt", "a+b.txt"},
+		{"a?b.txt", "a%3Fb.txt"},
+		{"a%20b.txt", "a%2520b.txt"},
+		{"a&b.txt", "a&amp;b.txt"},
+		{"a:b.txt", "./a:b.txt"},
+		{"é.txt", "%C3%A9.txt"},
+		{"日本語.txt", "%E6%97%A5%E6%9C%AC%E8%AA%9E.txt"},
+		{"dir #1", "dir%20%231/"},
+	}
+
+	root := t.TempDir()
+	for _, test := range tests {
+		if strings.HasSuffix(test.href, "/") {
+			writeTestFile(t, root, "list/"+test.name+"/index.html",
+				test.name)
+		} else {
+			writeTestFile(t, root, "list/"+test.name, test.name)
+		}
+	}
+
+	router := newTestRouter(newTestHandler(root))
+	resp := doRequest(router, "GET", "/list/", nil)
+	if resp.Code != 200 {
+		t.Fatalf("listing status %d", resp.Code)
+	}
+	listing := resp.Body.String()
+
+	base, err := url.Parse("/list/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		if !strings.Contains(listing, `href="`+test.href+`"`) {
+			t.Errorf("%q: listing has no href %q", test.name, test.href)
+			continue
+		}
+
+		ref, err := url.Parse(html.UnescapeString(test.href))
+		if err != nil {
+			t.Errorf("%q: %s", test.name, err)
+			continue
+		}
+		target := base.ResolveReference(ref).String()
+
+		resp := doRequest(router, "GET", target, nil)
+		if resp.Code != 200 || resp.Body.String() != test.name {
+			t.Errorf("%q: %s returned %d %q", test.name, target, resp.Code,
+				resp.Body.String())
+		}
+	}
+}
+
+func TestCaseCollisions(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "Foo", "upper")
+	writeTestFile(t, root, "foo", "lower")
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Skip("filesystem is case-insensitive")
+	}
+
+	h := newTestHandler(root)
+	h.CaseFold = true
+	router := newTestRouter(h)
+
+	tests := []struct {
+		target string
+		expect string
+	}{
+		{"/Foo", "upper"},
+		{"/foo", "lower"},
+		{"/FOO", "upper"},
+		{"/fOO", "upper"},
+	}
+
+	for _, test := range tests {
+		resp := doRequest(router, "GET", test.target, nil)
+		if resp.Code != 200 || resp.Body.String() != test.expect {
+			t.Errorf("%s: got %d %q, want %q", test.target, resp.Code,
+				resp.Body.String(), test.expect)
+		}
+	}
+
+	resp := doRequest(router, "GET", "/", nil)
+	if !strings.Contains(resp.Body.String(),
+		"Warning: names differ only by case: Foo, foo") {
+
+		t.Fatalf("listing does not warn about the collision: %s",
+			resp.Body.String())
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "dir/a.txt", "hello")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := os.Chtimes(filepath.Join(root, "dir", "a.txt"), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noCache := func(header http.Header) http.Header {
+		header.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		header.Set("Pragma", "no-cache")
+		header.Set("Expires", "0")
+		return header
+	}
+
+	router := newTestRouter(newTestHandler(root))
+
+	resp := doRequest(router, "GET", "/dir/a.txt", nil)
+	expect := noCache(http.Header{
+		"Accept-Ranges":  {"bytes"},
+		"Content-Length": {"5"},
+		"Content-Type":   {"text/plain; charset=utf-8"},
+		"Last-Modified":  {"Thu, 02 Jan 2020 03:04:05 GMT"},
+	})
+	if !reflect.DeepEqual(resp.Header(), expect) {
+		t.Errorf("file headers:\n%v\nwant:\n%v", resp.Header(), expect)
+	}
+
+	resp = doRequest(router, "GET", "/dir/", nil)
+	expect = noCache(http.Header{
+		"Content-Length": {strconv.Itoa(resp.Body.Len())},
+		"Content-Type":   {"text/html; charset=utf-8"},
+	})
+	if !reflect.DeepEqual(resp.Header(), expect) {
+		t.Errorf("listing headers:\n%v\nwant:\n%v", resp.Header(), expect)
+	}
+
+	h := newTestHandler(root)
+	h.GzipListing = true
+	router = newTestRouter(h)
+
+	req := httptest.NewRequest("GET", "/dir/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	gzipResp := httptest.NewRecorder()
+	router.ServeHTTP(gzipResp, req)
+	expect = noCache(http.Header{
+		"Content-Encoding": {"gzip"},
+		"Content-Length":   {strconv.Itoa(gzipResp.Body.Len())},
+		"Content-Type":     {"text/html; charset=utf-8"},
+		"Vary":             {"Accept-Encoding"},
+	})
+	if !reflect.DeepEqual(gzipResp.Header(), expect) {
+		t.Errorf("gzip listing headers:\n%v\nwant:\n%v", gzipResp.Header(),
+			expect)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "a/b/c.txt", "three")
+	writeTestFile(t, root, "a/b/c/d.txt", "four")
+	writeTestFile(t, root, "a/b/c/e/f/g/h.txt", "seven")
+
+	h := newTestHandler(root)
+	h.MaxDepth = 3
+	router := newTestRouter(h)
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/a/b/c.txt", 200},
+		{"/a/b/", 200},
+		{"/a/b/c/", 200},
+		{"/a/b/c/d.txt", 404},
+		{"/a/b/c/e/", 404},
+		{"/a/b/c/e/f/g/h.txt", 404},
+	}
+
+	for _, test := range tests {
+		resp := doRequest(router, "GET", test.target, nil)
+		if resp.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.target, resp.Code,
+				test.status)
+		}
+	}
+
+	resp := doRequest(router, "GET", "/a/b/", nil)
+	if !strings.Contains(resp.Body.String(), `href="c.txt"`) {
+		t.Errorf("listing at the limit misses a file: %s",
+			resp.Body.String())
+	}
+
+	resp = doRequest(router, "GET", "/a/b/c/", nil)
+	if strings.Contains(resp.Body.String(), "d.txt") {
+		t.Errorf("listing shows entries past the limit: %s",
+			resp.Body.String())
+	}
+}
+
+func TestRewriteRules(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "v1/a.txt", "v1")
+	writeTestFile(t, root, "v2/a.txt", "v2")
+	writeTestFile(t, root, "v2/old/a.txt", "v2 old")
+	writeTestFile(t, root, "v2/sub/b.txt", "b")
+
+	rules, err := parseRewriteRules([]string{
+		"^/docs/(.*)=/v2/$1",
+		"^/docs/old/(.*)=/v1/$1",
+		"^/latest$=/v2/a.txt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	rewriter := &Rewriter{
+		Rules: rules,
+	}
+	router.Use(rewriter.Handle)
+	newTestHandler(root).Setup(router)
+
+	tests := []struct {
+		target string
+		expect string
+	}{
+		{"/docs/a.txt", "v2"},
+		{"/docs/old/a.txt", "v2 old"},
+		{"/latest", "v2"},
+		{"/latest?download=1", "v2"},
+		{"/v1/a.txt", "v1"},
+	}
+
+	for _, test := range tests {
+		resp := doRequest(router, "GET", test.target, nil)
+		if resp.Code != 200 || resp.Body.String() != test.expect {
+			t.Errorf("%s: got %d %q, want %q", test.target, resp.Code,
+				resp.Body.String(), test.expect)
+		}
+	}
+
+	resp := doRequest(router, "GET", "/docs/sub/?json", nil)
+	listing := &jsonListing{}
+	err = json.Unmarshal(resp.Body.Bytes(), listing)
+	if err != nil {
+		t.Fatalf("query string lost in rewrite: %s", resp.Body.String())
+	}
+	if listing.Path != "/v2/sub/" || len(listing.Items) != 1 {
+		t.Fatalf("unexpected listing %+v", listing)
+	}
+
+	resp = doRequest(router, "GET", "/docs/sub?a=1&b=2", nil)
+	if resp.Header().Get("Location") != "/v2/sub/?a=1&b=2" {
+		t.Fatalf("redirect dropped the query: %q",
+			resp.Header().Get("Location"))
+	}
+}
+
+func TestSymlinkLoops(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "dir/real.txt", "real")
+
+	links := map[string]string{
+		"dir/self":  "self",
+		"dir/ping":  "pong",
+		"dir/pong":  "ping",
+		"dir/link1": "link2",
+		"dir/link2": "link3",
+		"dir/link3": "real.txt",
+		"dir/up":    "..",
+	}
+	for name, target := range links {
+		err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Skipf("symlinks unavailable: %s", err)
+		}
+	}
+
+	h := newTestHandler(root)
+	h.MaxSymlinkDepth = 2
+	router := newTestRouter(h)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		resp := doRequest(router, "GET", "/dir/", nil)
+		if resp.Code != 200 {
+			t.Errorf("listing status %d", resp.Code)
+		}
+		listing := resp.Body.String()
+		for _, name := range []string{"self", "ping", "pong", "link1"} {
+			if strings.Contains(listing, `href="`+name+`"`) {
+				t.Errorf("listing shows unresolvable link %s", name)
+			}
+		}
+		for _, href := range []string{"real.txt", "link2", "up/"} {
+			if !strings.Contains(listing, `href="`+href+`"`) {
+				t.Errorf("listing misses %s", href)
+			}
+		}
+
+		for _, target := range []string{"/dir/self", "/dir/ping",
+			"/dir/self/", "/dir/up/up/up/dir/self"} {
+
+			resp := doRequest(router, "GET", target, nil)
+			if resp.Code >= 500 {
+				t.Errorf("%s: status %d", target, resp.Code)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("symlink loop did not terminate")
+	}
+}
+
+func TestOwnerIndex(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "plain/index.html", "plain index")
+	writeTestFile(t, root, "i18n/index.en.html", "english index")
+	writeTestFile(t, root, "md/README.md", "# markdown index")
+
+	info, err := os.Stat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, ok := fileUid(info)
+	if !ok {
+		t.Skip("file owners unavailable")
+	}
+
+	for _, owner := range []int{uid, uid + 1} {
+		h := newTestHandler(root)
+		h.OwnerUid = owner
+		h.I18n = true
+		h.MarkdownIndex = []string{"README.md"}
+		router := newTestRouter(h)
+
+		for _, test := range []struct {
+			target string
+			body   string
+		}{
+			{"/plain/", "plain index"},
+			{"/i18n/", "english index"},
+			{"/md/", "markdown index"},
+		} {
+			req := httptest.NewRequest("GET", test.target, nil)
+			req.Header.Set("Accept-Language", "en")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			served := strings.Contains(resp.Body.String(), test.body)
+			if served != (owner == uid) {
+				t.Fatalf("owner %d %s: served %t, status %d", owner,
+					test.target, served, resp.Code)
+			}
+		}
+
+		resp := doRequest(router, "GET", "/plain/index.html", nil)
+		if (resp.Code == 404) == (owner == uid) {
+			t.Fatalf("owner %d: index.html status %d", owner, resp.Code)
+		}
+	}
+}
+
+func TestHealthCheckWarmup(t *testing.T) {
+	warmup := &Warmup{
+		RetryAfter: 7,
+	}
+	inFlight := &InFlight{}
+	health := &HealthCheck{
+		Path:     "/healthz",
+		Warmup:   warmup,
+		InFlight: inFlight,
+	}
+	maintenance := &Maintenance{}
+	maintenance.Toggle()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(health.Handle)
+	router.Use(inFlight.Handle)
+	router.Use(maintenance.Handle)
+	router.Use(warmup.Handle)
+	newTestHandler(t.TempDir()).Setup(router)
+
+	resp := doRequest(router, "GET", "/healthz", nil)
+	if resp.Code != 503 || resp.Header().Get("Retry-After") != "7" {
+		t.Fatalf("health during warmup: %d %q", resp.Code,
+			resp.Header().Get("Retry-After"))
+	}
+
+	warmup.Start(0)
+	deadline := time.Now().Add(5 * time.Second)
+	for !warmup.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("warmup did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	resp = doRequest(router, "GET", "/healthz", nil)
+	if resp.Code != 200 || resp.Header().Get("X-In-Flight") != "0" {
+		t.Fatalf("health after warmup: %d, in flight %q", resp.Code,
+			resp.Header().Get("X-In-Flight"))
+	}
+	resp = doRequest(router, "GET", "/", nil)
+	if resp.Code != 503 {
+		t.Fatalf("maintenance mode served %d", resp.Code)
+	}
+}
+
+func TestLocalizedIndexHeaders(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.fr.html",
+		"<html><body>bonjour</body></html>")
+
+	for _, liveReload := range []bool{false, true} {
+		h := newTestHandler(root)
+		h.I18n = true
+		h.CSP = "default-src 'self'"
+		h.CSPNonce = liveReload
+		h.LiveReload = liveReload
+		h.Preload = []PreloadRule{
+			{Pattern: "/", Link: "</app.css>; rel=preload; as=style"},
+		}
+		router := newTestRouter(h)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", "fr")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if liveReload {
+			h.liveReload.watcher.Close()
+		}
+
+		header := resp.Header()
+		if resp.Code != 200 || header.Get("Content-Language") != "fr" {
+			t.Fatalf("live reload %t: status %d, language %q", liveReload,
+				resp.Code, header.Get("Content-Language"))
+		}
+		if !strings.HasPrefix(header.Get("Content-Security-Policy"),
+			h.CSP) {
+
+			t.Fatalf("live reload %t: policy %q", liveReload,
+				header.Get("Content-Security-Policy"))
+		}
+		if header.Get("Link") != h.Preload[0].Link {
+			t.Fatalf("live reload %t: link %q", liveReload,
+				header.Get("Link"))
+		}
+		injected := strings.Contains(resp.Body.String(), liveReloadPath)
+		if injected != liveReload {
+			t.Fatalf("live reload %t: body %s", liveReload,
+				resp.Body.String())
+		}
+	}
+}
+
+func TestUnsatisfiableRange(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "small.txt", "0123456789")
+
+	h := newTestHandler(root)
+	h.MemFS = true
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "PUT", "/memory.txt", strings.NewReader("abc"))
+	if resp.Code != 201 {
+		t.Fatalf("put status %d", resp.Code)
+	}
+
+	for target, size := range map[string]int{
+		"/small.txt":  10,
+		"/memory.txt": 3,
+	} {
+		for _, ranges := range []string{"bytes=99999999-", "bytes=10-20"} {
+			req := httptest.NewRequest("GET", target, nil)
+			req.Header.Set("Range", ranges)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != 416 {
+				t.Fatalf("%s %s: status %d", target, ranges, resp.Code)
+			}
+			expect := fmt.Sprintf("bytes */%d", size)
+			if resp.Header().Get("Content-Range") != expect {
+				t.Fatalf("%s %s: Content-Range %q, want %q", target, ranges,
+					resp.Header().Get("Content-Range"), expect)
+			}
+		}
+	}
+}
+
+func TestMemFSExpectContinue(t *testing.T) {
+	h := newTestHandler(t.TempDir())
+	h.MemFS = true
+	server := httptest.NewServer(newTestRouter(h))
+	defer server.Close()
+
+	put := func(length int, body string) string {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		fmt.Fprintf(conn, "PUT /upload.txt HTTP/1.1\r\nHost: test\r\n"+
+			"Connection: close\r\nContent-Length: %d\r\n"+
+			"Expect: 100-continue\r\n\r\n", length)
+
+		buf := make([]byte, 512)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := string(buf[:n])
+		if !strings.HasPrefix(status, "HTTP/1.1 100 ") {
+			return status
+		}
+
+		_, err = io.WriteString(conn, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(conn)
+		return status + string(data)
+	}
+
+	status := put(memFSMaxFile+1, "")
+	if !strings.HasPrefix(status, "HTTP/1.1 413 ") {
+		t.Fatalf("oversized upload answered %q", status)
+	}
+
+	status = put(5, "small")
+	if !strings.HasPrefix(status, "HTTP/1.1 100 ") ||
+		!strings.Contains(status, "HTTP/1.1 201 ") {
+
+		t.Fatalf("small upload answered %q", status)
+	}
+}
+
+func TestMemFSPreconditions(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "disk.txt", "disk")
+
+	h := newTestHandler(root)
+	h.MemFS = true
+	router := newTestRouter(h)
+
+	write := func(method string, target string, body string,
+		header string, value string) *httptest.ResponseRecorder {
+
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := write("PUT", "/new.txt", "one", "If-None-Match", "*")
+	if resp.Code != 201 {
+		t.Fatalf("create with If-None-Match: status %d", resp.Code)
+	}
+	etag := resp.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on PUT")
+	}
+
+	resp = doRequest(router, "GET", "/new.txt", nil)
+	if resp.Header().Get("ETag") != etag {
+		t.Fatalf("GET ETag %q, PUT ETag %q", resp.Header().Get("ETag"), etag)
+	}
+
+	tests := []struct {
+		method string
+		target string
+		header string
+		value  string
+		status int
+	}{
+		{"PUT", "/new.txt", "If-None-Match", "*", 412},
+		{"PUT", "/disk.txt", "If-None-Match", "*", 412},
+		{"PUT", "/new.txt", "If-None-Match", "W/" + etag, 412},
+		{"PUT", "/new.txt", "If-Match", `"stale"`, 412},
+		{"PUT", "/new.txt", "If-Match", "W/" + etag, 412},
+		{"PUT", "/missing.txt", "If-Match", "*", 412},
+		{"DELETE", "/new.txt", "If-Match", `"stale"`, 412},
+		{"DELETE", "/missing.txt", "If-Match", "*", 412},
+		{"PUT", "/new.txt", "If-Match", `"stale", ` + etag, 204},
+		{"PUT", "/new.txt", "If-Match", etag, 412},
+		{"PUT", "/disk.txt", "If-Match", "*", 204},
+		{"DELETE", "/new.txt", "If-Match", "*", 204},
+	}
+	for _, test := range tests {
+		resp := write(test.method, test.target, "two", test.header,
+			test.value)
+		if resp.Code != test.status {
+			t.Fatalf("%s %s %s: %s: status %d, want %d", test.method,
+				test.target, test.header, test.value, resp.Code, test.status)
+		}
+	}
+
+	resp = doRequest(router, "GET", "/disk.txt", nil)
+	if resp.Body.String() != "two" {
+		t.Fatalf("If-Match * did not replace the disk file: %q",
+			resp.Body.String())
+	}
+}
+
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (n int, err error) {
+	if r.data == "" {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	n = copy(p, r.data)
+	r.data = r.data[n:]
+	return
+}
+
+func TestMemFSAtomicReplace(t *testing.T) {
+	h := newTestHandler(t.TempDir())
+	h.MemFS = true
+	router := newTestRouter(h)
+
+	bodies := []string{
+		strings.Repeat("a", 256<<10),
+		strings.Repeat("b", 256<<10),
+	}
+	resp := doRequest(router, "PUT", "/file.txt",
+		strings.NewReader(bodies[0]))
+	if resp.Code != 201 {
+		t.Fatalf("put status %d", resp.Code)
+	}
+
+	resp = doRequest(router, "PUT", "/file.txt",
+		&failingReader{data: bodies[1][:1000]})
+	if resp.Code != 400 {
+		t.Fatalf("interrupted put status %d", resp.Code)
+	}
+	resp = doRequest(router, "GET", "/file.txt", nil)
+	if resp.Body.String() != bodies[0] {
+		t.Fatal("interrupted put changed the file")
+	}
+
+	done := make(chan struct{})
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				resp := doRequest(router, "GET", "/file.txt", nil)
+				body := resp.Body.String()
+				if body != bodies[0] && body != bodies[1] {
+					t.Errorf("partial body of %d bytes", len(body))
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		resp := doRequest(router, "PUT", "/file.txt",
+			strings.NewReader(bodies[i%2]))
+		if resp.Code != 204 {
+			t.Errorf("put status %d", resp.Code)
+		}
+	}
+	close(done)
+	wait.Wait()
+}
+
+func TestSitemapLayers(t *testing.T) {
+	root := t.TempDir()
+	overlay := t.TempDir()
+	writeTestFile(t, root, "a.html", "a")
+	writeTestFile(t, root, "docs/b.html", "root b")
+	writeTestFile(t, overlay, "docs/b.html", "overlay b")
+	writeTestFile(t, overlay, "o.html", "o")
+
+	h := newTestHandler(root)
+	h.Overlays = []string{overlay}
+	h.MemFS = true
+	h.Sitemap = true
+	h.BaseURL = "https://example.com"
+	router := newTestRouter(h)
+
+	sitemap := func() string {
+		resp := doRequest(router, "GET", "/sitemap.xml", nil)
+		if resp.Code != 200 {
+			t.Fatalf("sitemap status %d", resp.Code)
+		}
+		return resp.Body.String()
+	}
+
+	resp := doRequest(router, "PUT", "/m.html", strings.NewReader("m"))
+	if resp.Code != 201 {
+		t.Fatalf("put status %d", resp.Code)
+	}
+	resp = doRequest(router, "DELETE", "/a.html", nil)
+	if resp.Code != 204 {
+		t.Fatalf("delete status %d", resp.Code)
+	}
+
+	data := sitemap()
+	for _, loc := range []string{"/docs/b.html", "/o.html", "/m.html"} {
+		if strings.Count(data, "https://example.com"+loc+"<") != 1 {
+			t.Fatalf("sitemap should list %s once: %s", loc, data)
+		}
+	}
+	if strings.Contains(data, "/a.html") {
+		t.Fatalf("sitemap lists a deleted file: %s", data)
+	}
+
+	modTime := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := os.Chtimes(filepath.Join(overlay, "docs", "b.html"), modTime,
+		modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sitemap(), "2030-01-02T03:04:05Z") {
+		t.Fatal("sitemap kept a stale lastmod after an in-place edit")
+	}
+}
+
+func TestSitemapConditional(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "docs/page.html", "page")
+	page := filepath.Join(root, "docs", "page.html")
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, path := range []string{root, filepath.Dir(page), page} {
+		err := os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := newTestHandler(root)
+	h.Sitemap = true
+	h.BaseURL = "https://example.com"
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "GET", "/sitemap.xml", nil)
+	etag := resp.Header().Get("ETag")
+	lastModified := resp.Header().Get("Last-Modified")
+	if resp.Code != 200 || etag == "" || lastModified == "" {
+		t.Fatalf("sitemap: status %d, ETag %q, Last-Modified %q", resp.Code,
+			etag, lastModified)
+	}
+
+	conditional := func(header string, value string) int {
+		req := httptest.NewRequest("GET", "/sitemap.xml", nil)
+		req.Header.Set(header, value)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := conditional("If-None-Match", etag); code != 304 {
+		t.Fatalf("unchanged If-None-Match: status %d", code)
+	}
+	if code := conditional("If-Modified-Since", lastModified); code != 304 {
+		t.Fatalf("unchanged If-Modified-Since: status %d", code)
+	}
+
+	modTime = modTime.Add(time.Hour)
+	err := os.Chtimes(page, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := conditional("If-None-Match", etag); code != 200 {
+		t.Fatalf("edited page If-None-Match: status %d", code)
+	}
+	if code := conditional("If-Modified-Since", lastModified); code != 200 {
+		t.Fatalf("edited page If-Modified-Since: status %d", code)
+	}
+}
+
+func TestQuotaStopsTransfers(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "large.bin", strings.Repeat("x", 4000))
+
+	quota := &Quota{
+		Limit:      1000,
+		RetryAfter: 5,
+	}
+	h := newTestHandler(root)
+	h.Quota = quota
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(quota.Handle)
+	h.Setup(router)
+
+	var wait sync.WaitGroup
+	sizes := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			resp := doRequest(router, "GET", "/large.bin", nil)
+			if resp.Code == 200 {
+				sizes <- resp.Body.Len()
+			}
+		}()
+	}
+	wait.Wait()
+	close(sizes)
+
+	total := 0
+	for size := range sizes {
+		total += size
+	}
+	if total != 1000 {
+		t.Fatalf("served %d file bytes with a 1000 byte quota", total)
+	}
+
+	resp := doRequest(router, "GET", "/large.bin", nil)
+	if resp.Code != 503 || resp.Header().Get("Retry-After") != "5" {
+		t.Fatalf("exhausted quota: status %d", resp.Code)
+	}
+	resp = doRequest(router, "GET", "/", nil)
+	if resp.Code != 200 {
+		t.Fatalf("listing after quota: status %d", resp.Code)
+	}
+}
+
+func TestVirtualHostOverlays(t *testing.T) {
+	root := t.TempDir()
+	overlay := t.TempDir()
+	vhostRoot := t.TempDir()
+	writeTestFile(t, root, "a.txt", "root")
+	writeTestFile(t, overlay, "a.txt", "overlay")
+	writeTestFile(t, vhostRoot, "a.txt", "vhost")
+
+	static := newTestHandler(root)
+	static.Overlays = []string{overlay}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	vhosts := &VirtualHosts{
+		Hosts: map[string]*StaticHandler{
+			"vhost.test": static.VirtualHost(vhostRoot),
+		},
+	}
+	router.Use(vhosts.Handle)
+	static.Setup(router)
+
+	for host, expect := range map[string]string{
+		"vhost.test": "vhost",
+		"other.test": "overlay",
+	} {
+		req := httptest.NewRequest("GET", "/a.txt", nil)
+		req.Host = host
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Body.String() != expect {
+			t.Fatalf("%s: body %q, want %q", host, resp.Body.String(),
+				expect)
+		}
+	}
+}
+
+func TestManifestServedFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "good.txt", "good")
+	writeTestFile(t, root, "bad.txt", "tampered")
+	writeTestFile(t, root, "site/index.html", "tampered")
+	writeTestFile(t, root, "docs/README.md", "tampered")
+
+	lines := ""
+	for name, data := range map[string]string{
+		"good.txt":        "good",
+		"bad.txt":         "bad",
+		"site/index.html": "index",
+		"docs/README.md":  "readme",
+	} {
+		sum := sha256.Sum256([]byte(data))
+		lines += hex.EncodeToString(sum[:]) + "  " + name + "\n"
+	}
+	manifestPath := filepath.Join(t.TempDir(), "SHA256SUMS")
+	err := os.WriteFile(manifestPath, []byte(lines), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := parseManifest(manifestPath, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHandler(root)
+	h.Manifest = manifest
+	h.Checksums = true
+	h.MarkdownIndex = []string{"README.md"}
+	router := newTestRouter(h)
+
+	for target, status := range map[string]int{
+		"/good.txt":                 200,
+		"/bad.txt":                  500,
+		"/site/":                    500,
+		"/docs/":                    500,
+		"/bad.txt?checksum=sha256":  500,
+		"/good.txt?checksum=sha256": 200,
+	} {
+		resp := doRequest(router, "GET", target, nil)
+		if resp.Code != status {
+			t.Fatalf("%s status %d, want %d", target, resp.Code, status)
+		}
+		if status == 500 && strings.Contains(resp.Body.String(), "tampered") {
+			t.Fatalf("%s served tampered content", target)
+		}
+	}
+
+	single := newTestHandler(filepath.Join(root, "bad.txt"))
+	single.Manifest = manifest
+	single.SingleFile = true
+	resp := doRequest(newTestRouter(single), "GET", "/anything", nil)
+	if resp.Code != 500 {
+		t.Fatalf("single file status %d, want 500", resp.Code)
+	}
+}
+
+func TestSingleFileQuota(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "large.bin", strings.Repeat("x", 4000))
+
+	quota := &Quota{
+		Limit:      1000,
+		RetryAfter: 5,
+	}
+	h := newTestHandler(filepath.Join(root, "large.bin"))
+	h.SingleFile = true
+	h.Quota = quota
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(quota.Handle)
+	h.Setup(router)
+
+	resp := doRequest(router, "GET", "/any/path", nil)
+	if resp.Code != 200 || resp.Body.Len() != 1000 {
+		t.Fatalf("first request status %d with %d bytes, want 1000 bytes",
+			resp.Code, resp.Body.Len())
+	}
+
+	resp = doRequest(router, "GET", "/", nil)
+	if resp.Code != 503 || resp.Header().Get("Retry-After") != "5" {
+		t.Fatalf("request past quota status %d", resp.Code)
+	}
+}
+
+func TestMetaRoute(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "a.txt", "a")
+
+	h := newTestHandler(root)
+	h.Meta = true
+	h.MemFS = true
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "POST", metaPath,
+		strings.NewReader(`["/a.txt"]`))
+	if resp.Code != 200 || !strings.Contains(resp.Body.String(), "a.txt") {
+		t.Fatalf("meta status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = doRequest(router, "POST", "/a.txt", nil)
+	if resp.Code != 405 ||
+		resp.Header().Get("Allow") != "GET, HEAD, PUT, DELETE" {
+
+		t.Fatalf("POST status %d allow %q", resp.Code,
+			resp.Header().Get("Allow"))
+	}
+}
+
+func TestCaseFoldCache(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "Docs/Guide.txt", "guide")
+	if _, err := os.Stat(filepath.Join(root, "docs")); err == nil {
+		t.Skip("filesystem is case-insensitive")
+	}
+
+	h := newTestHandler(root)
+	h.CaseFold = true
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "GET", "/docs/guide.txt", nil)
+	if resp.Code != 200 || resp.Body.String() != "guide" {
+		t.Fatalf("folded request got %d %q", resp.Code, resp.Body.String())
+	}
+	if len(h.folds.entries) != 2 {
+		t.Fatalf("cached %d folded listings, want 2", len(h.folds.entries))
+	}
+
+	writeTestFile(t, root, "Docs/Notes.txt", "notes")
+	modTime := time.Now().Add(time.Minute)
+	err := os.Chtimes(filepath.Join(root, "Docs"), modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp = doRequest(router, "GET", "/docs/notes.txt", nil)
+	if resp.Code != 200 || resp.Body.String() != "notes" {
+		t.Fatalf("request after change got %d %q", resp.Code,
+			resp.Body.String())
+	}
+}
+
+func TestPadTo(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "short.txt", strings.Repeat("x", 10))
+	writeTestFile(t, root, "aligned.txt", strings.Repeat("x", 64))
+
+	h := newTestHandler(root)
+	h.PadTo = 32
+	router := newTestRouter(h)
+
+	resp := doRequest(router, "GET", "/short.txt", nil)
+	if padding := resp.Header().Get("X-Padding"); len(padding) != 22 {
+		t.Fatalf("short file padding length %d, want 22", len(padding))
+	}
+	if resp.Body.Len() != 10 {
+		t.Fatalf("short file body length %d, want 10", resp.Body.Len())
+	}
+
+	resp = doRequest(router, "GET", "/aligned.txt", nil)
+	if _, ok := resp.Header()["X-Padding"]; ok {
+		t.Fatalf("aligned file padded with %d bytes",
+			len(resp.Header().Get("X-Padding")))
+	}
+}
+
+func benchmarkNoDelay(b *testing.B, noDelay bool) {
+	root := b.TempDir()
+	writeTestFile(b, root, "tile.png", strings.Repeat("x", 700))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: newTestRouter(newTestHandler(root)),
+	}
+	go server.Serve(&noDelayListener{
+		Listener: listener,
+		noDelay:  noDelay,
+	})
+	defer server.Close()
+
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network string,
+				addr string) (conn net.Conn, err error) {
+
+				conn, err = dialer.DialContext(ctx, network, addr)
+				if err != nil {
+					return
+				}
+				_ = conn.(*net.TCPConn).SetNoDelay(noDelay)
+				return
+			},
+			MaxIdleConnsPerHost: 1,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	target := "http://" + listener.Addr().String() + "/tile.png"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := client.Get(target)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+func BenchmarkNoDelay(b *testing.B) {
+	b.Run("on", func(b *testing.B) {
+		benchmarkNoDelay(b, true)
+	})
+	b.Run("off", func(b *testing.B) {
+		benchmarkNoDelay(b, false)
+	})
+}
+
+func benchmarkServe(b *testing.B, handler http.Handler, size int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: handler,
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := &http.Client{}
+	defer client.CloseIdleConnections()
+
+	target := "http://" + listener.Addr().String() + "/large.bin"
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := client.Get(target)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if n != int64(size) {
+			b.Fatalf("short body %d", n)
+		}
+	}
+}
+
+func BenchmarkCopyBuffer(b *testing.B) {
+	const size = 8 << 20
+
+	root := b.TempDir()
+	writeTestFile(b, root, "large.bin", strings.Repeat("x", size))
+
+	b.Run("fileserver", func(b *testing.B) {
+		benchmarkServe(b, newTestRouter(newTestHandler(root)), size)
+	})
+
+	for _, bufSize := range []int{4 << 10, 32 << 10, 256 << 10, 1 << 20} {
+		bufSize := bufSize
+		b.Run(fmt.Sprintf("buffer-%dk", bufSize>>10), func(b *testing.B) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/*filepath", func(c *gin.Context) {
+				file, err := os.Open(filepath.Join(root,
+					filepath.FromSlash(c.Param("filepath"))))
+				if err != nil {
+					c.AbortWithStatus(404)
+					return
+				}
+				defer file.Close()
+
+				buf := make([]byte, bufSize)
+				c.Writer.Header().Set("Content-Length", strconv.Itoa(size))
+				_, _ = io.CopyBuffer(struct{ io.Writer }{c.Writer},
+					struct{ io.Reader }{file}, buf)
+			})
+			benchmarkServe(b, router, size)
+		})
+	}
+}
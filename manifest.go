@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errManifestMismatch = errors.New("manifest: checksum mismatch")
+
+func parseManifest(manifestPath string, base string) (
+	manifest map[string][]byte, err error) {
+
+	base, err = filepath.Abs(base)
+	if err != nil {
+		return
+	}
+	base, err = filepath.EvalSymlinks(base)
+	if err != nil {
+		return
+	}
+
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	manifest = map[string][]byte{}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("invalid manifest line %d", lineNum)
+			return
+		}
+
+		sum, e := hex.DecodeString(parts[0])
+		if e != nil || len(sum) != 32 {
+			err = fmt.Errorf("invalid sha256 on manifest line %d", lineNum)
+			return
+		}
+
+		name := strings.TrimPrefix(strings.TrimLeft(parts[1], " "), "*")
+		manifest[filepath.Join(base,
+			filepath.FromSlash(path.Clean("/"+name)))] = sum
+	}
+
+	err = scanner.Err()
+	return
+}
+
+type manifestFS struct {
+	http.FileSystem
+	root    string
+	handler *StaticHandler
+}
+
+func (m manifestFS) Open(name string) (file http.File, err error) {
+	file, err = m.FileSystem.Open(name)
+	if err != nil {
+		return
+	}
+
+	err = m.handler.verifyFile(filepath.Join(m.root,
+		filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		file.Close()
+		file = nil
+	}
+	return
+}
+
+func (h *StaticHandler) verifyFile(filePath string) (err error) {
+	if h.Manifest == nil {
+		return
+	}
+
+	resolved, err := filepath.Abs(filePath)
+	if err != nil {
+		return
+	}
+	resolved, err = filepath.EvalSymlinks(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	expected, ok := h.Manifest[resolved]
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	sum, err := h.checksums.Sum(resolved, "sha256", info)
+	if err != nil {
+		return
+	}
+
+	if !bytes.Equal(sum, expected) {
+		fmt.Fprintf(gin.DefaultErrorWriter,
+			"[ALERT] %s | manifest mismatch | %s | expected=%s actual=%s\n",
+			time.Now().Format("2006/01/02 - 15:04:05"), filePath,
+			hex.EncodeToString(expected), hex.EncodeToString(sum))
+		err = errManifestMismatch
+		return
+	}
+
+	return
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+const markdownBody = `<html>
+<head><meta charset="utf-8"><title>%s</title></head>
+<body>
+%s</body>
+</html>
+`
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+)
+
+func (h *StaticHandler) HandleMarkdownIndex(path string, title string,
+	c *gin.Context) (ok bool, err error) {
+
+	indexPath := ""
+	for _, name := range h.MarkdownIndex {
+		exists, e := h.ownedExists(filepath.Join(path, name))
+		if e != nil {
+			err = e
+			return
+		}
+
+		if exists {
+			indexPath = filepath.Join(path, name)
+			break
+		}
+	}
+
+	if indexPath == "" {
+		return
+	}
+
+	err = h.verifyFile(indexPath)
+	if err != nil {
+		return
+	}
+
+	source, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	err = markdown.Convert(source, buf)
+	if err != nil {
+		return
+	}
+
+	if h.CSP != "" {
+		c.Writer.Header().Set("Content-Security-Policy", h.CSP)
+	}
+
+	ok = true
+	data := []byte(fmt.Sprintf(markdownBody, html.EscapeString(title),
+		buf.String()))
+	err = h.writeListing(c, data, nil)
+
+	return
+}
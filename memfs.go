@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	memFSMaxFile  = 32 << 20
+	memFSMaxBytes = 256 << 20
+)
+
+var (
+	errMemFSFull         = errors.New("memfs: memory layer is full")
+	errMemFSPrecondition = errors.New("memfs: precondition failed")
+)
+
+type memFile struct {
+	name    string
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+func memETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func etagListMatch(list string, etag string, strong bool) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if etag == "" {
+			continue
+		}
+
+		if !strong {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writePrecondition(r *http.Request) func(etag string,
+	exists bool) bool {
+
+	ifMatch := strings.Join(r.Header.Values("If-Match"), ",")
+	ifNoneMatch := strings.Join(r.Header.Values("If-None-Match"), ",")
+
+	return func(etag string, exists bool) bool {
+		if ifMatch != "" && (!exists ||
+			!etagListMatch(ifMatch, etag, true)) {
+
+			return false
+		}
+		if ifNoneMatch != "" && exists &&
+			etagListMatch(ifNoneMatch, etag, false) {
+
+			return false
+		}
+		return true
+	}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string {
+	return i.name
+}
+
+func (i *memFileInfo) Size() int64 {
+	return i.size
+}
+
+func (i *memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i *memFileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *memFileInfo) IsDir() bool {
+	return i.dir
+}
+
+func (i *memFileInfo) Sys() interface{} {
+	return nil
+}
+
+type memHTTPFile struct {
+	*bytes.Reader
+	info os.FileInfo
+}
+
+func (f *memHTTPFile) Close() error {
+	return nil
+}
+
+func (f *memHTTPFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, nil
+}
+
+func (f *memHTTPFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+type memFS struct {
+	base    http.FileSystem
+	lock    sync.RWMutex
+	files   map[string]*memFile
+	deleted map[string]bool
+	size    int
+	version uint64
+}
+
+func (m *memFS) Open(name string) (file http.File, err error) {
+	name = path.Clean("/" + name)
+
+	mem, deleted := m.Get(name)
+	if deleted {
+		err = os.ErrNotExist
+		return
+	}
+	if mem != nil {
+		file = &memHTTPFile{
+			Reader: bytes.NewReader(mem.data),
+			info: &memFileInfo{
+				name:    path.Base(name),
+				size:    int64(len(mem.data)),
+				modTime: mem.modTime,
+			},
+		}
+		return
+	}
+
+	file, err = m.base.Open(name)
+	if err != nil && os.IsNotExist(err) && m.IsDir(name) {
+		file = &memHTTPFile{
+			Reader: bytes.NewReader(nil),
+			info: &memFileInfo{
+				name: path.Base(name),
+				dir:  true,
+			},
+		}
+		err = nil
+	}
+	return
+}
+
+func (m *memFS) Get(name string) (file *memFile, deleted bool) {
+	name = path.Clean("/" + name)
+
+	m.lock.RLock()
+	file = m.files[name]
+	deleted = m.deleted[name]
+	m.lock.RUnlock()
+
+	return
+}
+
+func (m *memFS) IsDir(name string) bool {
+	prefix := strings.TrimSuffix(path.Clean("/"+name), "/") + "/"
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for key := range m.files {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memFS) ReadDir(name string) (items []os.FileInfo,
+	deleted []string) {
+
+	name = path.Clean("/" + name)
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	dirs := map[string]*memFileInfo{}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for key, file := range m.files {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		child := strings.TrimPrefix(key, prefix)
+		slash := strings.Index(child, "/")
+		if slash < 0 {
+			items = append(items, &memFileInfo{
+				name:    child,
+				size:    int64(len(file.data)),
+				modTime: file.modTime,
+			})
+			continue
+		}
+
+		child = child[:slash]
+		dir := dirs[child]
+		if dir == nil {
+			dir = &memFileInfo{
+				name: child,
+				dir:  true,
+			}
+			dirs[child] = dir
+			items = append(items, dir)
+		}
+		if file.modTime.After(dir.modTime) {
+			dir.modTime = file.modTime
+		}
+	}
+
+	for key := range m.deleted {
+		if path.Dir(key) == name {
+			deleted = append(deleted, path.Base(key))
+		}
+	}
+
+	return
+}
+
+func (m *memFS) Put(name string, data []byte, onDisk bool,
+	check func(etag string, exists bool) bool) (file *memFile,
+	created bool, err error) {
+
+	name = path.Clean("/" + name)
+	etag := memETag(data)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	prev, ok := m.files[name]
+	exists := ok || onDisk && !m.deleted[name]
+	current := ""
+	if ok {
+		current = prev.etag
+	}
+	if check != nil && !check(current, exists) {
+		err = errMemFSPrecondition
+		return
+	}
+
+	size := m.size + len(data)
+	if ok {
+		size -= len(prev.data)
+	}
+	if size > memFSMaxBytes {
+		err = errMemFSFull
+		return
+	}
+
+	if m.files == nil {
+		m.files = map[string]*memFile{}
+	}
+	file = &memFile{
+		name:    name,
+		data:    data,
+		etag:    etag,
+		modTime: time.Now(),
+	}
+	m.files[name] = file
+	delete(m.deleted, name)
+	m.size = size
+	m.version += 1
+	created = !exists
+
+	return
+}
+
+func (m *memFS) Delete(name string, onDisk bool,
+	check func(etag string, exists bool) bool) (err error) {
+
+	name = path.Clean("/" + name)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	file, ok := m.files[name]
+	if !ok && (!onDisk || m.deleted[name]) {
+		err = os.ErrNotExist
+		return
+	}
+	current := ""
+	if ok {
+		current = file.etag
+	}
+	if check != nil && !check(current, true) {
+		err = errMemFSPrecondition
+		return
+	}
+
+	if ok {
+		m.size -= len(file.data)
+		delete(m.files, name)
+	}
+	if onDisk {
+		if m.deleted == nil {
+			m.deleted = map[string]bool{}
+		}
+		m.deleted[name] = true
+	}
+	m.version += 1
+
+	return
+}
+
+func (m *memFS) List() (files []*memFile) {
+	m.lock.RLock()
+	for _, file := range m.files {
+		files = append(files, file)
+	}
+	m.lock.RUnlock()
+
+	return
+}
+
+func (m *memFS) Version() (version uint64) {
+	m.lock.RLock()
+	version = m.version
+	m.lock.RUnlock()
+	return
+}
+
+func (h *StaticHandler) HandleMemFile(c *gin.Context) (ok bool) {
+	file, deleted := h.memFS.Get(c.Param("filepath"))
+	if deleted {
+		ok = true
+		c.AbortWithStatus(404)
+		return
+	}
+	if file == nil {
+		return
+	}
+	ok = true
+
+	if h.ContentType != "" {
+		c.Writer.Header().Set("Content-Type", h.ContentType)
+	}
+	if h.CSP != "" && h.isHTML(file.name) {
+		c.Writer.Header().Set("Content-Security-Policy", h.CSP)
+	}
+	c.Writer.Header().Set("ETag", file.etag)
+
+	writer, release, allowed := h.fileWriter(c)
+	defer release()
+	if !allowed {
+		return
+	}
+
+	http.ServeContent(writer, c.Request, file.name, file.modTime,
+		bytes.NewReader(file.data))
+	return
+}
+
+func (h *StaticHandler) diskFile(name string) (exists bool, dir bool,
+	err error) {
+
+	info, err := os.Stat(h.resolvePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	exists = true
+	dir = info.IsDir()
+	return
+}
+
+func (h *StaticHandler) HandleMemWrite(c *gin.Context) {
+	reqPath := c.Param("filepath")
+	if !h.LaxPaths && !safePath(reqPath) {
+		c.AbortWithStatus(400)
+		return
+	}
+
+	if h.GitSafe && vcsPath(reqPath) ||
+		h.MaxDepth > 0 && pathDepth(reqPath) > h.MaxDepth {
+
+		c.AbortWithStatus(404)
+		return
+	}
+
+	name := path.Clean("/" + reqPath)
+	if name == "/" || strings.HasSuffix(reqPath, "/") {
+		c.AbortWithStatus(400)
+		return
+	}
+
+	_, reserved := h.routes[name]
+	if reserved || h.CAS && strings.HasPrefix(name, h.CASPrefix) {
+		c.AbortWithStatus(403)
+		return
+	}
+
+	parents := []string{}
+	for dir := path.Dir(name); dir != "/"; dir = path.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+	}
+	for _, dir := range parents {
+		file, deleted := h.memFS.Get(dir)
+		if file != nil || deleted {
+			c.AbortWithStatus(409)
+			return
+		}
+
+		exists, isDir, e := h.diskFile(dir)
+		if e != nil {
+			c.AbortWithError(500, e)
+			return
+		}
+		if exists && !isDir {
+			c.AbortWithStatus(409)
+			return
+		}
+	}
+
+	if h.memFS.IsDir(name) {
+		c.AbortWithStatus(409)
+		return
+	}
+	onDisk, isDir, err := h.diskFile(name)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	if isDir {
+		c.AbortWithStatus(409)
+		return
+	}
+
+	check := writePrecondition(c.Request)
+	file, deleted := h.memFS.Get(name)
+	current := ""
+	if file != nil {
+		current = file.etag
+	}
+	if !check(current, file != nil || onDisk && !deleted) {
+		c.AbortWithStatus(412)
+		return
+	}
+
+	if c.Request.Method == "DELETE" {
+		err = h.memFS.Delete(name, onDisk, check)
+		if err != nil {
+			if os.IsNotExist(err) {
+				c.AbortWithStatus(404)
+				return
+			}
+			if err == errMemFSPrecondition {
+				c.AbortWithStatus(412)
+				return
+			}
+			c.AbortWithError(500, err)
+			return
+		}
+
+		c.Status(204)
+		return
+	}
+
+	if c.Request.ContentLength > memFSMaxFile {
+		c.AbortWithStatus(413)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body,
+		memFSMaxFile+1))
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+	if len(data) > memFSMaxFile {
+		c.AbortWithStatus(413)
+		return
+	}
+
+	file, created, err := h.memFS.Put(name, data, onDisk, check)
+	if err != nil {
+		if err == errMemFSFull {
+			c.AbortWithStatus(507)
+			return
+		}
+		if err == errMemFSPrecondition {
+			c.AbortWithStatus(412)
+			return
+		}
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.Writer.Header().Set("ETag", file.etag)
+	if created {
+		c.Status(201)
+	} else {
+		c.Status(204)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	metaPath     = "/__meta"
+	metaMaxPaths = 1000
+	metaMaxBody  = 1 << 20
+)
+
+type fileMeta struct {
+	Path    string     `json:"path"`
+	Exists  bool       `json:"exists"`
+	Size    int64      `json:"size"`
+	IsDir   bool       `json:"is_dir"`
+	ModTime *time.Time `json:"modtime,omitempty"`
+}
+
+func (h *StaticHandler) statMeta(reqPath string) (meta fileMeta) {
+	meta.Path = path.Clean("/" + reqPath)
+
+	if !safePath(meta.Path) || h.GitSafe && vcsPath(meta.Path) ||
+		h.MaxDepth > 0 && pathDepth(meta.Path) > h.MaxDepth ||
+		meta.Path != "/" && h.hiddenFromListing(path.Base(meta.Path)) {
+
+		return
+	}
+
+	if h.SingleFile && meta.Path != "/" &&
+		meta.Path != "/"+filepath.Base(h.Root) {
+
+		return
+	}
+
+	info, err := os.Stat(h.resolvePath(meta.Path))
+	if err != nil || !info.IsDir() && !h.ownedBy(info) {
+		return
+	}
+
+	modTime := info.ModTime().UTC()
+	meta.Exists = true
+	meta.IsDir = info.IsDir()
+	meta.ModTime = &modTime
+	if !meta.IsDir {
+		meta.Size = info.Size()
+	}
+
+	return
+}
+
+func (h *StaticHandler) HandleMeta(c *gin.Context) {
+	paths := []string{}
+
+	decoder := json.NewDecoder(
+		http.MaxBytesReader(c.Writer, c.Request.Body, metaMaxBody))
+	err := decoder.Decode(&paths)
+	if err != nil {
+		c.AbortWithStatus(400)
+		return
+	}
+
+	if len(paths) > metaMaxPaths {
+		c.AbortWithStatus(413)
+		return
+	}
+
+	metas := make([]fileMeta, 0, len(paths))
+	for _, reqPath := range paths {
+		metas = append(metas, h.statMeta(reqPath))
+	}
+
+	c.JSON(200, metas)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+type overlayFS []http.FileSystem
+
+func (o overlayFS) Open(name string) (file http.File, err error) {
+	for _, fs := range o {
+		file, err = fs.Open(name)
+		if err != nil && notExist(err) {
+			err = os.ErrNotExist
+			continue
+		}
+		return
+	}
+	return
+}
+
+type ownerFS struct {
+	http.FileSystem
+	uid int
+}
+
+func (o ownerFS) Open(name string) (file http.File, err error) {
+	file, err = o.FileSystem.Open(name)
+	if err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		file = nil
+		return
+	}
+
+	uid, ok := fileUid(info)
+	if !info.IsDir() && ok && uid != o.uid {
+		file.Close()
+		file = nil
+		err = os.ErrNotExist
+	}
+	return
+}
+
+func (h *StaticHandler) roots() []string {
+	return append(append([]string{}, h.Overlays...), h.Root)
+}
+
+func (h *StaticHandler) resolvePath(reqPath string) (path string) {
+	if h.SingleFile {
+		path = h.Root
+		return
+	}
+
+	relPath := filepath.FromSlash(filepath.Clean("/" + reqPath))
+
+	for _, root := range h.Overlays {
+		path = filepath.Join(root, relPath)
+		exists, err := Exists(path)
+		if err != nil || exists {
+			return
+		}
+	}
+
+	path = filepath.Join(h.Root, relPath)
+	return
+}
+
+func (h *StaticHandler) readDirLayers(path string, c *gin.Context) (
+	items []os.FileInfo, dirs map[string]string, err error) {
+
+	dirs = map[string]string{}
+
+	if len(h.Overlays) == 0 && h.memFS == nil {
+		items, err = ioutil.ReadDir(path)
+		if err != nil {
+			return
+		}
+		for _, item := range items {
+			dirs[item.Name()] = path
+		}
+		return
+	}
+
+	if h.memFS != nil {
+		layer, deleted := h.memFS.ReadDir(c.Param("filepath"))
+		for _, name := range deleted {
+			dirs[name] = ""
+		}
+		for _, item := range layer {
+			dirs[item.Name()] = ""
+			items = append(items, item)
+		}
+	}
+
+	relPath := filepath.FromSlash(filepath.Clean("/" + c.Param("filepath")))
+	for _, root := range h.roots() {
+		dir := filepath.Join(root, relPath)
+		layer, e := ioutil.ReadDir(dir)
+		if e != nil {
+			if os.IsNotExist(e) {
+				continue
+			}
+			if dir != path {
+				isDir, _ := IsDirectory(dir)
+				if !isDir {
+					continue
+				}
+			}
+			err = e
+			return
+		}
+
+		for _, item := range layer {
+			if _, ok := dirs[item.Name()]; ok {
+				continue
+			}
+			dirs[item.Name()] = dir
+			items = append(items, item)
+		}
+	}
+
+	return
+}
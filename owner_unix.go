@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+type nameCache struct {
+	lock  sync.Mutex
+	names map[uint32]string
+}
+
+func (s *nameCache) Lookup(id uint32,
+	lookup func(id string) (name string, err error)) (name string) {
+
+	s.lock.Lock()
+	name, ok := s.names[id]
+	s.lock.Unlock()
+	if ok {
+		return
+	}
+
+	name = strconv.FormatUint(uint64(id), 10)
+	found, err := lookup(name)
+	if err == nil {
+		name = found
+	}
+
+	s.lock.Lock()
+	if s.names == nil {
+		s.names = map[uint32]string{}
+	}
+	s.names[id] = name
+	s.lock.Unlock()
+
+	return
+}
+
+var (
+	userNames  = &nameCache{}
+	groupNames = &nameCache{}
+)
+
+func lookupUserName(id string) (name string, err error) {
+	usr, err := user.LookupId(id)
+	if err != nil {
+		return
+	}
+
+	name = usr.Username
+	return
+}
+
+func lookupGroupName(id string) (name string, err error) {
+	grp, err := user.LookupGroupId(id)
+	if err != nil {
+		return
+	}
+
+	name = grp.Name
+	return
+}
+
+func fileOwner(info os.FileInfo) (owner string, group string, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	owner = userNames.Lookup(uint32(stat.Uid), lookupUserName)
+	group = groupNames.Lookup(uint32(stat.Gid), lookupGroupName)
+	return
+}
+
+func fileUid(info os.FileInfo) (uid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	uid = int(stat.Uid)
+	return
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+func fileOwner(info os.FileInfo) (owner string, group string, ok bool) {
+	return
+}
+
+func fileUid(info os.FileInfo) (uid int, ok bool) {
+	return
+}
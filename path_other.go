@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+func unsafeOSPath(pth string) bool {
+	return false
+}
@@ -0,0 +1,51 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"strings"
+)
+
+var reservedNames = map[string]bool{
+	"CON":  true,
+	"PRN":  true,
+	"AUX":  true,
+	"NUL":  true,
+	"COM1": true,
+	"COM2": true,
+	"COM3": true,
+	"COM4": true,
+	"COM5": true,
+	"COM6": true,
+	"COM7": true,
+	"COM8": true,
+	"COM9": true,
+	"LPT1": true,
+	"LPT2": true,
+	"LPT3": true,
+	"LPT4": true,
+	"LPT5": true,
+	"LPT6": true,
+	"LPT7": true,
+	"LPT8": true,
+	"LPT9": true,
+}
+
+func unsafeOSPath(pth string) bool {
+	if strings.ContainsAny(pth, `\:`) {
+		return true
+	}
+
+	for _, name := range strings.Split(pth, "/") {
+		name = strings.TrimRight(name, ". ")
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[:i]
+		}
+		if reservedNames[strings.ToUpper(name)] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	robotsAllow = "User-agent: *\nDisallow:\n"
+	robotsDeny  = "User-agent: *\nDisallow: /\n"
+)
+
+func (h *StaticHandler) HandleRobots(c *gin.Context) {
+	path := h.resolvePath("/robots.txt")
+	exists, err := Exists(path)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+	if !exists && h.Robots != "allow" && h.Robots != "deny" {
+		path = h.Robots
+		exists = true
+	}
+
+	if exists {
+		http.ServeFile(c.Writer, c.Request, path)
+		return
+	}
+
+	data := robotsAllow
+	if h.Robots == "deny" {
+		data = robotsDeny
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(c.Writer, c.Request, "robots.txt", time.Time{},
+		bytes.NewReader([]byte(data)))
+}
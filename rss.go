@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	Guid    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+func (h *StaticHandler) linkBase(c *gin.Context) string {
+	if h.BaseURL != "" {
+		return strings.TrimSuffix(h.BaseURL, "/")
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func (h *StaticHandler) HandleDirFeed(pathFrm string, items *Items,
+	c *gin.Context) (err error) {
+
+	files := []Item{}
+	for _, item := range items.items {
+		if !item.IsDir {
+			files = append(files, item)
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime.After(files[j].ModTime)
+	})
+
+	dirUrl := &url.URL{
+		Path: pathFrm,
+	}
+	link := h.linkBase(c) + dirUrl.EscapedPath()
+
+	feed := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Index of " + pathFrm,
+			Link:        link,
+			Description: "Recently modified files in " + pathFrm,
+		},
+	}
+
+	for _, file := range files {
+		fileUrl := &url.URL{
+			Path: pathFrm + file.Name,
+		}
+		fileLink := h.linkBase(c) + fileUrl.EscapedPath()
+
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:   file.Name,
+			Link:    fileLink,
+			Guid:    fileLink + "#" + file.ModTime.UTC().Format(time.RFC3339),
+			PubDate: file.ModTime.Format(time.RFC1123Z),
+		})
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+
+	c.Data(200, "application/rss+xml; charset=utf-8", data)
+
+	return
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func watchMaintenance(m *Maintenance) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1)
+
+	go func() {
+		for range sigChan {
+			if m.Toggle() {
+				fmt.Println("Maintenance mode enabled")
+			} else {
+				fmt.Println("Maintenance mode disabled")
+			}
+		}
+	}()
+}
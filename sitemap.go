@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapCache struct {
+	lock    sync.Mutex
+	stamps  map[string]time.Time
+	version uint64
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+func (s *sitemapCache) valid(version uint64) bool {
+	if s.data == nil || s.version != version {
+		return false
+	}
+
+	for path, modTime := range s.stamps {
+		stat, err := os.Lstat(path)
+		if err != nil || !stat.ModTime().Equal(modTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *StaticHandler) sitemapLoc(relPath string) string {
+	relPath = filepath.ToSlash(relPath)
+	if relPath == "index.html" {
+		relPath = ""
+	} else if strings.HasSuffix(relPath, "/index.html") {
+		relPath = strings.TrimSuffix(relPath, "index.html")
+	}
+
+	loc := &url.URL{
+		Path: "/" + relPath,
+	}
+	return strings.TrimSuffix(h.BaseURL, "/") + loc.EscapedPath()
+}
+
+func (h *StaticHandler) sitemapPage(relPath string) bool {
+	ext := strings.ToLower(filepath.Ext(relPath))
+	if ext != ".html" && ext != ".htm" {
+		return false
+	}
+
+	return h.MaxDepth <= 0 || pathDepth(relPath) <= h.MaxDepth
+}
+
+func (h *StaticHandler) generateSitemap() (data []byte,
+	stamps map[string]time.Time, modTime time.Time, err error) {
+
+	stamps = map[string]time.Time{}
+	seen := map[string]bool{}
+	urlSet := &sitemapURLSet{
+		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+	}
+
+	if h.memFS != nil {
+		for _, file := range h.memFS.List() {
+			relPath := strings.TrimPrefix(file.name, "/")
+			seen[relPath] = true
+
+			hidden := false
+			for _, name := range strings.Split(relPath, "/") {
+				hidden = hidden || h.hiddenFromListing(name)
+			}
+			if hidden || !h.sitemapPage(relPath) {
+				continue
+			}
+
+			if file.modTime.After(modTime) {
+				modTime = file.modTime
+			}
+			urlSet.URLs = append(urlSet.URLs, sitemapURL{
+				Loc:     h.sitemapLoc(relPath),
+				LastMod: file.modTime.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	for _, root := range h.roots() {
+		err = filepath.Walk(root, func(path string, info os.FileInfo,
+			e error) error {
+
+			if e != nil {
+				if os.IsPermission(e) || path == root && os.IsNotExist(e) {
+					return nil
+				}
+				return e
+			}
+
+			if path != root && h.hiddenFromListing(info.Name()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			relPath, e := filepath.Rel(root, path)
+			if e != nil {
+				return e
+			}
+
+			if h.MaxDepth > 0 && pathDepth(relPath) > h.MaxDepth {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if info.IsDir() {
+				stamps[path] = info.ModTime()
+				if info.ModTime().After(modTime) {
+					modTime = info.ModTime()
+				}
+				return nil
+			}
+
+			relPath = filepath.ToSlash(relPath)
+			if seen[relPath] || !h.sitemapPage(relPath) {
+				return nil
+			}
+			seen[relPath] = true
+			stamps[path] = info.ModTime()
+			if info.ModTime().After(modTime) {
+				modTime = info.ModTime()
+			}
+
+			if h.memFS != nil {
+				_, deleted := h.memFS.Get(relPath)
+				if deleted {
+					return nil
+				}
+			}
+			if !h.ownedBy(info) {
+				return nil
+			}
+
+			urlSet.URLs = append(urlSet.URLs, sitemapURL{
+				Loc:     h.sitemapLoc(relPath),
+				LastMod: info.ModTime().UTC().Format(time.RFC3339),
+			})
+
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	sort.Slice(urlSet.URLs, func(i, j int) bool {
+		return urlSet.URLs[i].Loc < urlSet.URLs[j].Loc
+	})
+
+	data, err = xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+
+	return
+}
+
+func (h *StaticHandler) HandleSitemap(c *gin.Context) {
+	version := uint64(0)
+	if h.memFS != nil {
+		version = h.memFS.Version()
+	}
+
+	h.sitemap.lock.Lock()
+	if !h.sitemap.valid(version) {
+		data, stamps, modTime, err := h.generateSitemap()
+		if err != nil {
+			h.sitemap.lock.Unlock()
+			c.AbortWithError(500, err)
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		h.sitemap.data = data
+		h.sitemap.etag = `"` + hex.EncodeToString(sum[:]) + `"`
+		h.sitemap.stamps = stamps
+		h.sitemap.version = version
+		h.sitemap.modTime = modTime
+	}
+	data := h.sitemap.data
+	etag := h.sitemap.etag
+	modTime := h.sitemap.modTime
+	h.sitemap.lock.Unlock()
+
+	c.Writer.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	c.Writer.Header().Set("ETag", etag)
+	http.ServeContent(c.Writer, c.Request, "sitemap.xml", modTime,
+		bytes.NewReader(data))
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+const reusePortSupported = false
+
+func reusePortControl(network string, address string,
+	conn syscall.RawConn) (err error) {
+
+	return
+}
+
+const backlogSupported = false
+
+func setBacklog(listener net.Listener, backlog int) (err error) {
+	return
+}
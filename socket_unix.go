@@ -0,0 +1,52 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package main
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const reusePortSupported = true
+
+func reusePortControl(network string, address string,
+	conn syscall.RawConn) (err error) {
+
+	e := conn.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET,
+			unix.SO_REUSEPORT, 1)
+	})
+	if e != nil {
+		err = e
+		return
+	}
+
+	return
+}
+
+const backlogSupported = true
+
+func setBacklog(listener net.Listener, backlog int) (err error) {
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return
+	}
+
+	conn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	e := conn.Control(func(fd uintptr) {
+		err = unix.Listen(int(fd), backlog)
+	})
+	if e != nil {
+		err = e
+		return
+	}
+
+	return
+}
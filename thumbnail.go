@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbWidth     = 200
+	thumbMaxWidth  = 1024
+	thumbMaxPixels = 50000000
+	thumbMaxBytes  = 64 << 20
+)
+
+var errThumbTooLarge = errors.New("image too large for thumbnail")
+
+var thumbExts = map[string]bool{
+	".gif":  true,
+	".jpeg": true,
+	".jpg":  true,
+	".png":  true,
+	".webp": true,
+}
+
+func isThumbImage(name string) bool {
+	return thumbExts[strings.ToLower(filepath.Ext(name))]
+}
+
+type thumbKey struct {
+	path  string
+	width int
+}
+
+type thumbEntry struct {
+	modTime     time.Time
+	size        int64
+	contentType string
+	data        []byte
+}
+
+type thumbCache struct {
+	lock    sync.Mutex
+	entries map[thumbKey]thumbEntry
+	bytes   int
+}
+
+func (s *thumbCache) Get(path string, width int, info os.FileInfo) (
+	contentType string, data []byte, err error) {
+
+	key := thumbKey{
+		path:  path,
+		width: width,
+	}
+
+	s.lock.Lock()
+	entry, ok := s.entries[key]
+	s.lock.Unlock()
+
+	if ok && entry.modTime.Equal(info.ModTime()) &&
+		entry.size == info.Size() {
+
+		contentType = entry.contentType
+		data = entry.data
+		return
+	}
+
+	contentType, data, err = generateThumbnail(path, width)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	if s.entries == nil || s.bytes+len(data) > thumbMaxBytes {
+		s.entries = map[thumbKey]thumbEntry{}
+		s.bytes = 0
+	}
+	if old, ok := s.entries[key]; ok {
+		s.bytes -= len(old.data)
+	}
+	s.bytes += len(data)
+	s.entries[key] = thumbEntry{
+		modTime:     info.ModTime(),
+		size:        info.Size(),
+		contentType: contentType,
+		data:        data,
+	}
+	s.lock.Unlock()
+
+	return
+}
+
+func generateThumbnail(path string, width int) (
+	contentType string, data []byte, err error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	conf, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return
+	}
+	if conf.Width < 1 || conf.Height < 1 ||
+		int64(conf.Width)*int64(conf.Height) > thumbMaxPixels {
+
+		err = errThumbTooLarge
+		return
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+
+	src, format, err := image.Decode(file)
+	if err != nil {
+		return
+	}
+
+	bounds := src.Bounds()
+	if bounds.Dx() < 1 || bounds.Dy() < 1 {
+		err = image.ErrFormat
+		return
+	}
+	if width > bounds.Dx() {
+		width = bounds.Dx()
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height > thumbMaxWidth {
+		height = thumbMaxWidth
+		width = bounds.Dx() * height / bounds.Dy()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	buf := &bytes.Buffer{}
+	if format == "jpeg" {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(buf, dst, &jpeg.Options{
+			Quality: 80,
+		})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(buf, dst)
+	}
+	if err != nil {
+		return
+	}
+	data = buf.Bytes()
+
+	return
+}
+
+func (h *StaticHandler) HandleThumbnail(path string, c *gin.Context) (
+	ok bool, err error) {
+
+	if c.Query("thumb") != "1" || !isThumbImage(path) {
+		return
+	}
+
+	width := thumbWidth
+	if w := c.Query("w"); w != "" {
+		width, err = strconv.Atoi(w)
+		if err != nil || width < 1 || width > thumbMaxWidth {
+			err = nil
+			ok = true
+			c.AbortWithStatus(400)
+			return
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if info.IsDir() {
+		return
+	}
+
+	err = h.verifyFile(path)
+	if err != nil {
+		return
+	}
+
+	contentType, data, err := h.thumbnails.Get(path, width, info)
+	if err != nil {
+		if os.IsPermission(err) {
+			return
+		}
+		status := 415
+		if err == errThumbTooLarge {
+			status = 413
+		}
+		err = nil
+		ok = true
+		c.AbortWithStatus(status)
+		return
+	}
+
+	ok = true
+	c.Data(200, contentType, data)
+
+	return
+}